@@ -0,0 +1,134 @@
+//go:build js && wasm
+
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Command gobib-wasm is gobib built for WebAssembly: it converts
+// plain TeX bibliographies in the browser. It defines the global
+// JavaScript function
+//
+//	gobibConvert(text, options) -> {output, entries, diagnostics, warnings, error}
+//
+// where options is an object like {"sort": "key", "default-year": "2018"},
+// with the names of the command line flags.
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+func main() {
+	js.Global().Set("gobibConvert", js.FuncOf(convert))
+	// the function must be there as long as the page is
+	select {}
+}
+
+// convert is gobibConvert. The conversion runs synchronously,
+// without waiting for any goroutine, since it's called by the
+// JavaScript event loop.
+func convert(this js.Value, args []js.Value) interface{} {
+	result := map[string]interface{}{
+		"output":      "",
+		"entries":     0,
+		"diagnostics": []interface{}{},
+		"warnings":    []interface{}{},
+		"error":       nil,
+	}
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		result["error"] = "gobibConvert(text, options): text must be a string"
+		return result
+	}
+
+	var output, warnings strings.Builder
+	config := &gobib.Config{
+		Input:    strings.NewReader(args[0].String()),
+		Output:   &output,
+		Warnings: &warnings,
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		if err := setOptions(config, args[1]); err != nil {
+			result["error"] = err.Error()
+			return result
+		}
+	}
+
+	converter := gobib.NewConverter(config)
+	if err := converter.Run(); err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+
+	var diagnostics []interface{}
+	for _, entry := range converter.Entries() {
+		for _, diagnostic := range gobib.Validate(entry) {
+			diagnostics = append(diagnostics, map[string]interface{}{
+				"rule":     diagnostic.Rule,
+				"severity": diagnostic.Severity.String(),
+				"key":      diagnostic.Key,
+				"field":    diagnostic.Field,
+				"message":  diagnostic.Message,
+				"line":     diagnostic.Source.Line,
+			})
+		}
+	}
+	var warningLines []interface{}
+	for _, line := range strings.Split(warnings.String(), "\n") {
+		if line != "" {
+			warningLines = append(warningLines, strings.TrimPrefix(line, "warning: "))
+		}
+	}
+
+	result["output"] = output.String()
+	result["entries"] = converter.Written()
+	if diagnostics != nil {
+		result["diagnostics"] = diagnostics
+	}
+	if warningLines != nil {
+		result["warnings"] = warningLines
+	}
+	return result
+}
+
+// setOptions sets the options of the config from a JavaScript
+// object, whose values may be strings, numbers or booleans.
+func setOptions(config *gobib.Config, options js.Value) error {
+	for _, name := range gobib.Options {
+		value := options.Get(name)
+		var text string
+		switch value.Type() {
+		case js.TypeUndefined, js.TypeNull:
+			continue
+		case js.TypeString:
+			text = value.String()
+		case js.TypeNumber:
+			text = strconv.FormatFloat(value.Float(), 'f', -1, 64)
+		case js.TypeBoolean:
+			text = strconv.FormatBool(value.Bool())
+		default:
+			return fmt.Errorf("%w %s: %s", gobib.ErrOption, name, value.Type())
+		}
+		if err := config.SetOption(name, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// batchExtensions are the extensions of the files converted
+// when walking a directory.
+var batchExtensions = map[string]bool{".tex": true, ".bbl": true}
+
+// batchJob is a file converted by a batch.
+type batchJob struct {
+	input  string
+	output string
+}
+
+// batchResult is how the conversion of a file went.
+type batchResult struct {
+	entries int
+	status  string
+	failed  bool
+}
+
+// convertCommand is the 'convert' command: without arguments it
+// converts -in to -out, otherwise each of its arguments, which can
+// be files, globs or, with -r, directories.
+func convertCommand(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	setFlags(flags)
+	recursive := flags.Bool("r", false, "convert the .tex and .bbl files of the directories, recursively")
+	outDir := flags.String("out-dir", "", "the directory where the .bib files are written, by default next to each input")
+	workers := flags.Int("j", runtime.NumCPU(), "how many files are converted at once")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib convert [flags] [-r] [-out-dir=dir] file.tex|glob|dir...\n")
+		flags.PrintDefaults()
+	}
+	// flags can follow the files, as in 'convert -r papers/ -out-dir bib/'
+	var inputs []string
+	parseFlags("convert", flags, args)
+	for flags.NArg() > 0 {
+		inputs = append(inputs, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+
+	if len(inputs) == 0 {
+		return single()
+	}
+	if watchInput || keymap != "" {
+		fmt.Fprintf(os.Stderr, "Error: -watch and -keymap can't be used with several files\n")
+		return 2
+	}
+
+	config, err := newConfig()
+	if err == nil && *workers < 1 {
+		err = fmt.Errorf("wrong 'j' value: %d", *workers)
+	}
+	var jobs []batchJob
+	if err == nil {
+		jobs, err = batchJobs(inputs, *recursive, *outDir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 2
+	}
+
+	results := runBatch(config, jobs, *workers)
+	return printSummary(jobs, results)
+}
+
+// batchJobs returns the files to convert, given the arguments. The
+// output of a file is named like it, with the .bib extension, and
+// it's put in outDir, if set, keeping the path relative to the
+// directory it was found in.
+func batchJobs(args []string, recursive bool, outDir string) ([]batchJob, error) {
+	var jobs []batchJob
+	inputs := make(map[string]bool)
+	outputs := make(map[string]string)
+
+	add := func(input, relative string) error {
+		if inputs[input] {
+			return nil
+		}
+		inputs[input] = true
+
+		name := strings.TrimSuffix(relative, filepath.Ext(relative)) + ".bib"
+		output := filepath.Join(filepath.Dir(input), filepath.Base(name))
+		if outDir != "" {
+			output = filepath.Join(outDir, name)
+		}
+		if other, ok := outputs[output]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", other, input, output)
+		}
+		outputs[output] = input
+		jobs = append(jobs, batchJob{input: input, output: output})
+		return nil
+	}
+
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %s", arg)
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if err = add(match, filepath.Base(match)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if !recursive {
+				return nil, fmt.Errorf("%s is a directory, use -r to convert its files", match)
+			}
+
+			var files []string
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() && batchExtensions[strings.ToLower(filepath.Ext(path))] {
+					files = append(files, path)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(files)
+			for _, file := range files {
+				relative, _ := filepath.Rel(match, file)
+				if err = add(file, relative); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// runBatch converts the files using at most workers goroutines.
+// The warnings of each file are printed once it's converted.
+func runBatch(config *gobib.Config, jobs []batchJob, workers int) []batchResult {
+	results := make([]batchResult, len(jobs))
+	indexes := make(chan int)
+	var printing sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				var warnings bytes.Buffer
+				results[index] = runJob(config, jobs[index], &warnings)
+
+				printing.Lock()
+				for _, line := range strings.SplitAfter(warnings.String(), "\n") {
+					if line != "" {
+						fmt.Fprintf(os.Stderr, "%s: %s", jobs[index].input, line)
+					}
+				}
+				printing.Unlock()
+			}
+		}()
+	}
+
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// runJob converts a file, writing the warnings to warnings.
+func runJob(config *gobib.Config, job batchJob, warnings *bytes.Buffer) batchResult {
+	run := *config
+	run.Warnings = warnings
+
+	if err := os.MkdirAll(filepath.Dir(job.output), 0755); err != nil {
+		return batchResult{status: "error: " + err.Error(), failed: true}
+	}
+	_, entries, err := convert(&run, job.input, job.output, "")
+	switch {
+	case errors.Is(err, gobib.ErrBibEmpty):
+		return batchResult{status: "no bibliography"}
+	case err != nil:
+		return batchResult{entries: entries, status: "error: " + err.Error(), failed: true}
+	}
+	return batchResult{entries: entries, status: "ok"}
+}
+
+// printSummary prints a table telling how the conversion of each
+// file went. It returns the exit status, 1 if any failed.
+func printSummary(jobs []batchJob, results []batchResult) int {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "INPUT\tOUTPUT\tENTRIES\tSTATUS\n")
+
+	converted, empty, failed := 0, 0, 0
+	for i, result := range results {
+		output := jobs[i].output
+		switch {
+		case result.failed:
+			failed++
+			output = "-"
+		case result.status == "ok":
+			converted++
+		default:
+			empty++
+			output = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", jobs[i].input, output, result.entries, result.status)
+	}
+	table.Flush()
+
+	fmt.Printf("\n%d converted, %d without a bibliography, %d failed\n", converted, empty, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
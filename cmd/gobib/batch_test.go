@@ -0,0 +1,121 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const batchFirst = `
+\begin{thebibliography}{9}
+	\bibitem{wcf}
+	Ross Anderson, Why Cryptosystems Fail, 1993
+
+	\bibitem{wcdf}
+	Ross Anderson, Why Cryptosystems Don't Fail
+\end{thebibliography}
+`
+
+const batchSecond = `
+\begin{thebibliography}{9}
+	\bibitem{aass}
+	Asking Alexandria, Someone Somewhere, 2011
+\end{thebibliography}
+`
+
+const batchFirstBib = `@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1993",
+}
+
+@online{wcdf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Don't Fail}},
+}
+
+`
+
+const batchSecondBib = `@online{aass,
+	author = "Asking Alexandria",
+	title = {{Someone Somewhere}},
+	year = "2011",
+}
+
+`
+
+// captureStdout returns what f writes to the standard output.
+func captureStdout(t *testing.T, f func()) string {
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = file
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	return readFile(t, file.Name())
+}
+
+func TestConvertBatch(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "gobib.toml")
+	files := map[string]string{"a.tex": batchFirst, "b.tex": batchSecond, "gobib.toml": ""}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("GOBIB_CONFIG", config)
+	outDir := filepath.Join(dir, "bib")
+
+	var status int
+	summary := captureStdout(t, func() {
+		status = convertCommand([]string{"-j", "2", filepath.Join(dir, "*.tex"), "-out-dir", outDir})
+	})
+	if status != 0 {
+		t.Errorf("Expected status 0, got %d", status)
+	}
+
+	gotExpected(readFile(t, filepath.Join(outDir, "a.bib")), batchFirstBib, t)
+	gotExpected(readFile(t, filepath.Join(outDir, "b.bib")), batchSecondBib, t)
+
+	// the rows keep the order of the inputs, whichever ends first
+	var rows [][]string
+	for _, line := range strings.Split(summary, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			rows = append(rows, fields)
+		}
+	}
+	expected := [][]string{
+		{"INPUT", "OUTPUT", "ENTRIES", "STATUS"},
+		{filepath.Join(dir, "a.tex"), filepath.Join(outDir, "a.bib"), "2", "ok"},
+		{filepath.Join(dir, "b.tex"), filepath.Join(outDir, "b.bib"), "1", "ok"},
+		{"2", "converted,", "0", "without", "a", "bibliography,", "0", "failed"},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Wrong summary:\n%s", summary)
+	}
+	for i := range expected {
+		gotExpected(strings.Join(rows[i], " "), strings.Join(expected[i], " "), t)
+	}
+}
@@ -0,0 +1,378 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configNames are the names of the project config files, looked
+// for in the current directory and in its parents.
+var configNames = []string{".gobib.toml", ".gobib.yaml", ".gobib.yml"}
+
+// pathFlags are the flags naming files: when they're set by a
+// config file, the relative paths are relative to its directory.
+var pathFlags = map[string]bool{
+	"in":            true,
+	"out":           true,
+	"cited":         true,
+	"keymap":        true,
+	"out-dir":       true,
+	"provenance":    true,
+	"rules":         true,
+	"resolve-cache": true,
+	"library":       true,
+}
+
+// errConfigSyntax is returned when a config file can't be parsed.
+var errConfigSyntax = errors.New("syntax error")
+
+// projectConfig holds the settings of a config file: the defaults
+// of the flags, by section. The settings outside any section are
+// used by every command having such a flag, those in a section
+// only by the command it's named after.
+type projectConfig struct {
+	path     string
+	sections map[string]map[string]string
+}
+
+// findConfig reads the config file set by GOBIB_CONFIG or, if not
+// set, the first one found going up from the current directory.
+// It returns nil if there's none.
+func findConfig() (*projectConfig, error) {
+	if name := os.Getenv("GOBIB_CONFIG"); name != "" {
+		return readConfig(name)
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for _, name := range configNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return readConfig(path)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// readConfig reads a config file, TOML or YAML according to its
+// extension.
+func readConfig(name string) (*projectConfig, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := &projectConfig{path: name, sections: map[string]map[string]string{"": {}}}
+	if ext := filepath.Ext(name); ext == ".yaml" || ext == ".yml" {
+		err = config.parseYAML(bufio.NewScanner(file))
+	} else {
+		err = config.parseTOML(bufio.NewScanner(file))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return config, nil
+}
+
+// set sets a setting, which can't be set twice. The '_' in the
+// keys are read as '-', so that default_year is default-year.
+func (c *projectConfig) set(section, key, value string, line int) error {
+	key = strings.Replace(key, "_", "-", -1)
+	if c.sections[section] == nil {
+		c.sections[section] = make(map[string]string)
+	}
+	if _, ok := c.sections[section][key]; ok {
+		return fmt.Errorf("line %d: %s is set twice", line, key)
+	}
+	c.sections[section][key] = value
+	return nil
+}
+
+// resolve returns the comma separated paths of a setting relative
+// to the current directory instead of to the config file.
+func (c *projectConfig) resolve(value string) string {
+	paths := strings.Split(value, ",")
+	for i, path := range paths {
+		path = strings.TrimSpace(path)
+		if path != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(c.path), path)
+		}
+		paths[i] = path
+	}
+	return strings.Join(paths, ",")
+}
+
+// parseTOML parses the subset of TOML used by the config: tables,
+// keys set to strings, numbers, booleans or arrays of them, which
+// are joined by commas, and comments.
+func (c *projectConfig) parseTOML(scanner *bufio.Scanner) error {
+	section := ""
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			if section == "" || strings.ContainsAny(section, "[]") {
+				return fmt.Errorf("line %d: %w: wrong table name", line, errConfigSyntax)
+			}
+			continue
+		}
+
+		eq := strings.Index(text, "=")
+		if eq < 0 {
+			return fmt.Errorf("line %d: %w: expected key = value", line, errConfigSyntax)
+		}
+		key, err := unquote(strings.TrimSpace(text[:eq]))
+		if err != nil || key == "" {
+			return fmt.Errorf("line %d: %w: wrong key", line, errConfigSyntax)
+		}
+		value, err := configValue(strings.TrimSpace(text[eq+1:]))
+		if err != nil {
+			return fmt.Errorf("line %d: %w: %s", line, errConfigSyntax, err.Error())
+		}
+		if err = c.set(section, key, value, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseYAML parses the subset of YAML used by the config: keys
+// set to scalars or lists, which are joined by commas, either at
+// the top level or inside a mapping named after a command.
+func (c *projectConfig) parseYAML(scanner *bufio.Scanner) error {
+	// section is the mapping the indented keys belong to; a key
+	// without a value is either a mapping or a list, listKey,
+	// which one is known by the next line
+	section, listKey, listSection := "", "", ""
+	var list []string
+	listLine := 0
+
+	flush := func() error {
+		var err error
+		if list != nil {
+			err = c.set(listSection, listKey, strings.Join(list, ","), listLine)
+		}
+		listKey, list = "", nil
+		return err
+	}
+
+	for line := 1; scanner.Scan(); line++ {
+		raw := stripComment(scanner.Text())
+		text := strings.TrimSpace(raw)
+		if text == "" || text == "---" {
+			continue
+		}
+		indented := raw[0] == ' ' || raw[0] == '\t'
+
+		if text == "-" || strings.HasPrefix(text, "- ") {
+			if listKey == "" {
+				return fmt.Errorf("line %d: %w: list item outside a list", line, errConfigSyntax)
+			}
+			if listSection == "" {
+				// a list of a top level key, not a mapping
+				section = ""
+			}
+			item, err := unquote(strings.TrimSpace(text[1:]))
+			if err != nil {
+				return fmt.Errorf("line %d: %w: %s", line, errConfigSyntax, err.Error())
+			}
+			list = append(list, item)
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		colon := strings.Index(text, ":")
+		if colon < 0 {
+			return fmt.Errorf("line %d: %w: expected key: value", line, errConfigSyntax)
+		}
+		key, err := unquote(strings.TrimSpace(text[:colon]))
+		if err != nil || key == "" {
+			return fmt.Errorf("line %d: %w: wrong key", line, errConfigSyntax)
+		}
+		value := strings.TrimSpace(text[colon+1:])
+
+		if !indented {
+			section = ""
+		} else if section == "" {
+			return fmt.Errorf("line %d: %w: unexpected indentation", line, errConfigSyntax)
+		}
+		if value == "" {
+			listKey, listSection, listLine = key, section, line
+			if !indented {
+				section = key
+			}
+			continue
+		}
+
+		if value, err = configValue(value); err != nil {
+			return fmt.Errorf("line %d: %w: %s", line, errConfigSyntax, err.Error())
+		}
+		if err = c.set(section, key, value, line); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// stripComment removes a '#' comment, unless it's inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// configValue returns a value as the string a flag is set to: an
+// array, [a, b], becomes a,b.
+func configValue(value string) (string, error) {
+	if !strings.HasPrefix(value, "[") {
+		return unquote(value)
+	}
+	if !strings.HasSuffix(value, "]") {
+		return "", errors.New("unterminated array")
+	}
+
+	var items []string
+	for _, item := range strings.Split(value[1:len(value)-1], ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			// the trailing comma
+			continue
+		}
+		item, err := unquote(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// unquote returns a quoted string without its quotes, and a bare
+// value as it is.
+func unquote(value string) (string, error) {
+	if len(value) == 0 || (value[0] != '"' && value[0] != '\'') {
+		return value, nil
+	}
+	if len(value) < 2 || value[len(value)-1] != value[0] {
+		return "", fmt.Errorf("unterminated string %s", value)
+	}
+	if value[0] == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+	return strconv.Unquote(value)
+}
+
+// envName returns the environment variable setting a flag, like
+// GOBIB_DEFAULT_YEAR for -default-year.
+func envName(flag string) string {
+	return "GOBIB_" + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// setDefaults sets the flags of a command from the environment
+// variables and, for those not set by them, from the config file.
+// The flags given on the command line override both, since they're
+// parsed later.
+func setDefaults(command string, flags *flag.FlagSet, config *projectConfig) error {
+	if config != nil {
+		for key := range config.sections[command] {
+			if flags.Lookup(key) == nil {
+				return fmt.Errorf("%s: unknown setting %s in %s", config.path, key, command)
+			}
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if err = flags.Set(f.Name, value); err != nil {
+				err = fmt.Errorf("%s: wrong value %q: %w", envName(f.Name), value, err)
+			}
+			return
+		}
+		if config == nil {
+			return
+		}
+		value, ok := config.sections[command][f.Name]
+		if !ok {
+			value, ok = config.sections[""][f.Name]
+		}
+		if ok {
+			if pathFlags[f.Name] {
+				value = config.resolve(value)
+			}
+			if err = flags.Set(f.Name, value); err != nil {
+				err = fmt.Errorf("%s: %s: wrong value %q: %w", config.path, f.Name, value, err)
+			}
+		}
+	})
+	return err
+}
+
+// parseFlags parses the flags of a command, after setting their
+// defaults from the environment and the config file, so that a
+// flag overrides an environment variable, which overrides the
+// config file. It exits if they're wrong.
+func parseFlags(command string, flags *flag.FlagSet, args []string) {
+	config, err := findConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the config: %s\n", err.Error())
+		os.Exit(2)
+	}
+	if err = setDefaults(command, flags, config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(2)
+	}
+	flags.Parse(args)
+}
@@ -0,0 +1,256 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseConfig parses a config, in YAML if yaml is set, in TOML
+// otherwise.
+func parseConfig(content string, yaml bool) (*projectConfig, error) {
+	config := &projectConfig{path: "/project/.gobib.toml", sections: map[string]map[string]string{"": {}}}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	if yaml {
+		return config, config.parseYAML(scanner)
+	}
+	return config, config.parseTOML(scanner)
+}
+
+func TestParseConfig(t *testing.T) {
+	var tests = []struct {
+		name     string
+		yaml     bool
+		content  string
+		expected map[string]map[string]string
+	}{
+		{
+			name: "toml quoting",
+			content: `dialect = "biblatex"
+key-pattern = '{author}{year}'
+default_year = 1970
+"sort" = "a \"b\""
+`,
+			expected: map[string]map[string]string{"": {
+				"dialect":      "biblatex",
+				"key-pattern":  "{author}{year}",
+				"default-year": "1970",
+				"sort":         `a "b"`,
+			}},
+		},
+		{
+			name: "toml comments and tables",
+			content: `# the defaults
+dialect = "biblatex" # for biber
+
+[convert]
+out = "refs#1.bib" # the hash is quoted
+force = true
+`,
+			expected: map[string]map[string]string{
+				"":        {"dialect": "biblatex"},
+				"convert": {"out": "refs#1.bib", "force": "true"},
+			},
+		},
+		{
+			name: "toml arrays",
+			content: `[lint]
+rules = ["missing-year", 'no-authors', ]
+empty = []
+`,
+			expected: map[string]map[string]string{
+				"":     {},
+				"lint": {"rules": "missing-year,no-authors", "empty": ""},
+			},
+		},
+		{
+			name: "yaml",
+			yaml: true,
+			content: `---
+dialect: 'biblatex' # for biber
+convert:
+  out: "refs#1.bib"
+  force: true
+lint:
+  rules:
+    - missing-year
+    - "no-authors"
+sort: [key, year]
+`,
+			expected: map[string]map[string]string{
+				"":        {"dialect": "biblatex", "sort": "key,year"},
+				"convert": {"out": "refs#1.bib", "force": "true"},
+				"lint":    {"rules": "missing-year,no-authors"},
+			},
+		},
+		{
+			name: "yaml top level list",
+			yaml: true,
+			content: `rules:
+  - missing-year
+dialect: biblatex
+`,
+			expected: map[string]map[string]string{
+				"": {"rules": "missing-year", "dialect": "biblatex"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		config, err := parseConfig(test.content, test.yaml)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(config.sections, test.expected) {
+			t.Errorf("%s:\nGot: %v\nExp: %v", test.name, config.sections, test.expected)
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		yaml    bool
+		content string
+		syntax  bool
+	}{
+		{name: "toml no value", content: "dialect\n", syntax: true},
+		{name: "toml no key", content: "= biblatex\n", syntax: true},
+		{name: "toml empty table", content: "[]\n", syntax: true},
+		{name: "toml nested table", content: "[[convert]]\n", syntax: true},
+		{name: "toml unterminated string", content: "dialect = \"biblatex\n", syntax: true},
+		{name: "toml unterminated array", content: "rules = [a, b\n", syntax: true},
+		{name: "toml set twice", content: "dialect = a\ndialect = b\n"},
+		{name: "toml set twice by _", content: "default-year = 1\ndefault_year = 2\n"},
+		{name: "yaml no value", yaml: true, content: "dialect\n", syntax: true},
+		{name: "yaml list item", yaml: true, content: "- a\n", syntax: true},
+		{name: "yaml indentation", yaml: true, content: "  dialect: a\n", syntax: true},
+		{name: "yaml unterminated string", yaml: true, content: "dialect: 'a\n", syntax: true},
+		{name: "yaml set twice", yaml: true, content: "convert:\n  out: a\n  out: b\n"},
+	}
+
+	for _, test := range tests {
+		_, err := parseConfig(test.content, test.yaml)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if errors.Is(err, errConfigSyntax) != test.syntax {
+			t.Errorf("%s: wrong error: %s", test.name, err)
+		}
+		if !strings.HasPrefix(err.Error(), "line ") {
+			t.Errorf("%s: the error doesn't tell the line: %s", test.name, err)
+		}
+	}
+}
+
+func TestStripComment(t *testing.T) {
+	var tests = []struct{ line, expected string }{
+		{"a = b # c", "a = b "},
+		{"# a", ""},
+		{`a = "b # c" # d`, `a = "b # c" `},
+		{`a = 'b " # c' # d`, `a = 'b " # c' `},
+		{"a = b", "a = b"},
+	}
+	for _, test := range tests {
+		gotExpected(stripComment(test.line), test.expected, t)
+	}
+}
+
+// testFlags returns a flag set like those of the commands.
+func testFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.String("dialect", "bibtex", "")
+	flags.String("sort", "none", "")
+	flags.String("dedup", "off", "")
+	flags.String("key-pattern", "", "")
+	flags.String("out", "", "")
+	flags.Int("default-year", 0, "")
+	return flags
+}
+
+func TestSetDefaults(t *testing.T) {
+	config, err := parseConfig(`dialect = "biblatex"
+sort = "key"
+dedup = "report"
+key-pattern = "{title}"
+unknown = "the top level is shared by every command"
+
+[convert]
+dedup = "merge"
+key-pattern = "{author}"
+out = "bib/refs.bib"
+
+[lint]
+rules = "only lint has it"
+`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flag > env > config, and the section of the command > the
+	// top level
+	t.Setenv("GOBIB_SORT", "year")
+	t.Setenv("GOBIB_DEDUP", "keep-first")
+	flags := testFlags()
+	if err = setDefaults("convert", flags, config); err != nil {
+		t.Fatal(err)
+	}
+	if err = flags.Parse([]string{"-dedup", "off"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"dialect":      "biblatex",
+		"sort":         "year",
+		"dedup":        "off",
+		"key-pattern":  "{author}",
+		"out":          filepath.Join("/project", "bib", "refs.bib"),
+		"default-year": "0",
+	}
+	for name, value := range expected {
+		gotExpected(flags.Lookup(name).Value.String(), value, t)
+	}
+}
+
+func TestSetDefaultsErrors(t *testing.T) {
+	config, err := parseConfig("[convert]\nrules = \"lint only\"\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = setDefaults("convert", testFlags(), config); err == nil || !strings.Contains(err.Error(), "unknown setting rules") {
+		t.Errorf("Expected an unknown setting error, got %v", err)
+	}
+
+	config, _ = parseConfig("default-year = \"soon\"\n", false)
+	if err = setDefaults("convert", testFlags(), config); err == nil || !strings.Contains(err.Error(), "default-year") {
+		t.Errorf("Expected a wrong value error, got %v", err)
+	}
+
+	t.Setenv("GOBIB_DEFAULT_YEAR", "soon")
+	if err = setDefaults("convert", testFlags(), nil); err == nil || !strings.Contains(err.Error(), "GOBIB_DEFAULT_YEAR") {
+		t.Errorf("Expected a wrong value error, got %v", err)
+	}
+}
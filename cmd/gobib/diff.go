@@ -0,0 +1,81 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// diff is the 'diff' command: it compares two bibliographies,
+// BibTeX or plain TeX, entry by entry.
+func diff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib diff old.bib|old.tex new.bib|new.tex\n")
+		flags.PrintDefaults()
+	}
+	parseFlags("diff", flags, args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	var entries [2][]*gobib.Entry
+	for i, name := range flags.Args() {
+		read, err := readEntries(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", name, err.Error())
+			return 2
+		}
+		entries[i] = read
+	}
+
+	changes := gobib.DiffEntries(entries[0], entries[1])
+	for _, change := range changes {
+		switch change.Kind {
+		case gobib.EntryAdded:
+			fmt.Printf("+ %s (%s)\n", change.New.Key, change.New.Source)
+		case gobib.EntryRemoved:
+			fmt.Printf("- %s (%s)\n", change.Old.Key, change.Old.Source)
+		case gobib.EntryChanged:
+			fmt.Printf("~ %s\n", change.New.Key)
+		case gobib.EntryRenamed:
+			fmt.Printf("> %s -> %s (%s)\n", change.Old.Key, change.New.Key, change.Reason)
+		}
+		for _, field := range change.Fields {
+			fmt.Printf("    %s:\n", field.Field)
+			if field.Old != "" {
+				fmt.Printf("      - %s\n", field.Old)
+			}
+			if field.New != "" {
+				fmt.Printf("      + %s\n", field.New)
+			}
+		}
+	}
+
+	// like diff, 1 means there are differences
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
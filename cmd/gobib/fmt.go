@@ -0,0 +1,167 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// formatter rewrites BibTeX files canonically.
+type formatter struct {
+	format gobib.Format
+	order  gobib.SortOrder
+}
+
+// bibFmt is the 'fmt' command: like gofmt, it rewrites BibTeX
+// files in a canonical format.
+func bibFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	indent := flags.String("indent", "tab", "the indentation of the fields: tab, or a number of spaces")
+	align := flags.Bool("align", true, "align the '=' of the fields")
+	sortBy := flags.String("sort", "none", "sort the entries by: none, key, author, year, year-desc, title or type")
+	monthMacros := flags.Bool("months", true, "write the months as the macros jan, feb, ...")
+	trailingComma := flags.Bool("trailing-comma", true, "write a comma after the last field")
+	check := flags.Bool("check", false, "don't write anything, exit with status 1 if a file isn't formatted")
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib fmt [-check|-w] [file.bib...]\n")
+		flags.PrintDefaults()
+	}
+	parseFlags("fmt", flags, args)
+
+	f := &formatter{
+		format: gobib.Format{
+			Protection:      gobib.ProtectKeep,
+			Indent:          "\t",
+			Align:           *align,
+			Braces:          true,
+			FieldOrder:      gobib.CanonicalFieldOrder,
+			MonthMacros:     *monthMacros,
+			NoTrailingComma: !*trailingComma,
+			OmitEmpty:       true,
+			KeepMacros:      true,
+		},
+	}
+	if *indent != "tab" {
+		spaces, err := strconv.Atoi(*indent)
+		if err != nil || spaces < 0 {
+			fmt.Fprintf(os.Stderr, "Error in 'indent' value: %s\n", *indent)
+			return 2
+		}
+		f.format.Indent = strings.Repeat(" ", spaces)
+	}
+	order, ok := gobib.SortOrders[*sortBy]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error in 'sort' value: %s\n", *sortBy)
+		return 2
+	}
+	f.order = order
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "Error: can't use -w with stdin\n")
+			return 2
+		}
+		return f.file("", os.Stdin, *check, false)
+	}
+
+	exit := 0
+	for _, name := range flags.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file %s: %s\n", name, err.Error())
+			exit = 1
+			continue
+		}
+		if status := f.file(name, file, *check, *write); status != 0 {
+			exit = status
+		}
+		file.Close()
+	}
+	return exit
+}
+
+// file formats a file, printing the result or, with write,
+// writing it back. With check nothing is written, the name of
+// the file is printed if it isn't formatted.
+func (f *formatter) file(name string, r io.Reader, check, write bool) int {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", name, err.Error())
+		return 1
+	}
+	formatted, err := f.bytes(content, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+
+	switch {
+	case check:
+		if !bytes.Equal(content, formatted) {
+			if name == "" {
+				name = "<stdin>"
+			}
+			fmt.Println(name)
+			return 1
+		}
+	case write:
+		if bytes.Equal(content, formatted) {
+			return 0
+		}
+		if err := writeAtomic(name, formatted); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing file %s: %s\n", name, err.Error())
+			return 1
+		}
+	default:
+		os.Stdout.Write(formatted)
+	}
+	return 0
+}
+
+// bytes returns the content of a BibTeX file formatted.
+func (f *formatter) bytes(content []byte, name string) ([]byte, error) {
+	file, err := gobib.ParseBibTeXFile(bytes.NewReader(content), name)
+	if err != nil {
+		return nil, err
+	}
+	file.Sort(f.order)
+
+	var result bytes.Buffer
+	if file.Preamble != "" {
+		result.WriteString(file.Preamble + "\n\n")
+	}
+	for _, entry := range file.Entries {
+		if entry.Comment != "" {
+			result.WriteString(entry.Comment + "\n\n")
+		}
+		result.WriteString(entry.Formatted(f.format) + "\n\n")
+	}
+	if file.Trailer != "" {
+		result.WriteString(file.Trailer + "\n")
+	}
+	return append(bytes.TrimRight(result.Bytes(), "\n"), '\n'), nil
+}
@@ -19,6 +19,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
@@ -34,95 +35,295 @@ var (
 	defaultVisited string
 	visited        time.Time
 	printFinished  bool
+	cited          string
+	citedOrder     string
+	keyPattern     string
+	keymap         string
+	dedup          string
+	conflict       string
+	duplicateKeys  string
+	protection     string
+	titleCase      string
+	sortBy         string
+	group          bool
+	dialect        string
+	watchInput     bool
+	force          bool
+	backup         bool
+	update         bool
 )
 
-func setFlags() {
-	flag.StringVar(&input, "in", os.Stdin.Name(), "the input file")
-	flag.StringVar(&output, "out", os.Stdout.Name(), "the output file")
-	flag.IntVar(&year, "default-year", gobib.NoDefaultYear, "the default year value to use when a year is not found")
-	flag.StringVar(&defaultVisited, "default-urldate", "", "the default urldate value to use, the format is YYYY-MM-DD")
-	flag.BoolVar(&printFinished, "print-finished", false, "print a message when conversion is finished")
+// setFlags defines the flags of a conversion on flags.
+func setFlags(flags *flag.FlagSet) {
+	flags.StringVar(&input, "in", os.Stdin.Name(), "the input file")
+	flags.StringVar(&output, "out", os.Stdout.Name(), "the output file")
+	flags.BoolVar(&printFinished, "print-finished", false, "print a message when conversion is finished")
+	flags.StringVar(&cited, "cited", "", "the .tex or .aux file citing the entries, if set only the cited entries are written")
+	flags.StringVar(&citedOrder, "cited-order", "citation", "the order of the cited entries: citation or alphabetical")
+	flags.BoolVar(&watchInput, "watch", false, "convert again whenever the input, or a file it includes, changes")
+	flags.BoolVar(&force, "force", false, "overwrite the output file if it exists")
+	flags.BoolVar(&backup, "backup", false, "overwrite the output file keeping its previous version as .bak")
+	flags.BoolVar(&update, "update", false, "overwrite the output file only if its content changes")
+	flags.StringVar(&keymap, "keymap", "", "the file where the changed keys are written to, to be used with 'gobib rekey'")
+	setEntryFlags(flags)
+	setResolveFlags(flags)
+}
+
+// setEntryFlags defines on flags the flags telling how the
+// entries are converted, which don't depend on the files.
+func setEntryFlags(flags *flag.FlagSet) {
+	flags.IntVar(&year, "default-year", gobib.NoDefaultYear, "the default year value to use when a year is not found")
+	flags.StringVar(&defaultVisited, "default-urldate", "", "the default urldate of the entries with an URL, YYYY-MM-DD or mtime, the date the input was last modified")
+	flags.StringVar(&keyPattern, "key-pattern", "", "the pattern used to generate every key, e.g. {author}{year}{title}")
+	flags.StringVar(&dedup, "dedup", "off", "what to do with duplicate entries: off, report, keep-first or merge")
+	flags.StringVar(&conflict, "dedup-conflict", "first", "which value is kept when merging duplicates: first, last or longest")
+	flags.StringVar(&duplicateKeys, "duplicate-keys", "warn", "what to do when two entries have the same key: warn, disambiguate or error")
+	flags.StringVar(&protection, "title-protection", "whole", "what is protected by braces in titles: whole or smart (acronyms, proper nouns, ...)")
+	flags.StringVar(&titleCase, "title-case", "keep", "the case ALL-CAPS titles are converted to: keep, title or sentence")
+	flags.StringVar(&sortBy, "sort", "none", "sort the entries by: none, key, author, year, year-desc, title or type")
+	flags.BoolVar(&group, "group", false, "precede each group of sorted entries, e.g. each year, by a comment")
+	flags.StringVar(&dialect, "dialect", "bibtex", "how the dates are written: bibtex (year, month) or biblatex (date)")
+}
+
+// readCitations returns the keys cited by a .tex or .aux file.
+func readCitations(name string) (*gobib.Citations, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return gobib.ExtractCitations(file, name)
+}
+
+// command is a gobib command, like 'gobib lint'.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	flag.Parse()
+// commands are the gobib commands.
+var commands = []command{
+	{"convert", "convert plain TeX bibliographies to BibTeX", convertCommand},
+	{"lint", "check the entries of bibliographies", lint},
+	{"fmt", "rewrite BibTeX files in a canonical format", bibFmt},
+	{"merge", "merge several bibliographies into one", merge},
+	{"diff", "compare two bibliographies entry by entry", diff},
+	{"rekey", "change the keys cited by LaTeX documents", rekey},
+	{"zotero", "import bibliographies into Zotero", zoteroImport},
+	{"serve", "run the HTTP conversion service", serve},
+	{"lsp", "run the language server, over stdin and stdout", languageServer},
+	{"version", "print the gobib version", printVersion},
+}
+
+// usage prints the commands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: gobib <command> [flags] [arguments]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(out, "  %-8s  %s\n", command.name, command.summary)
+	}
+	fmt.Fprintf(out, "\nRun 'gobib <command> -h' for the flags of a command. Without a command,\n")
+	fmt.Fprintf(out, "gobib works like 'gobib convert'. The flags can be set by a .gobib.toml\n")
+	fmt.Fprintf(out, "or .gobib.yaml file, or by GOBIB_* environment variables.\n")
 }
 
 func main() {
 
-	setFlags()
-	var err error
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "help", "-h", "-help", "--help":
+			usage()
+			os.Exit(0)
+		}
+		for _, command := range commands {
+			if command.name == os.Args[1] {
+				os.Exit(command.run(os.Args[2:]))
+			}
+		}
+	}
 
+	// 'gobib -in=bib.tex -out=bib.bib' is still 'gobib convert'
+	setFlags(flag.CommandLine)
+	parseFlags("convert", flag.CommandLine, os.Args[1:])
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %s\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(single())
+}
+
+// newConfig returns the conversion config set by the flags.
+func newConfig() (*gobib.Config, error) {
 	var finalDefaultVisited = gobib.NoDefaultURLDate
 
-	if defaultVisited != "" {
+	// with mtime the date is set by convert, for each file
+	if defaultVisited != "" && defaultVisited != "mtime" {
+		var err error
 		visited, err = time.Parse("2006-01-02", defaultVisited)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error in 'default-urldate' format")
-			os.Exit(-1)
+			return nil, fmt.Errorf("wrong 'default-urldate' format, it must be YYYY-MM-DD or mtime")
 		}
 		finalDefaultVisited = &visited
-	} else {
-		finalDefaultVisited = nil
 	}
 
-	var inputFile, outputFile *os.File
-	if input != os.Stdin.Name() {
-		inputFile, err = os.Open(input)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening file %s: %s", input, err.Error())
-			os.Exit(-1)
-		}
-	} else {
-		inputFile = os.Stdin
+	// -cited-order and -resolve-mode are not flags of 'serve'
+	order, ok := gobib.CitationOrders[citedOrder]
+	if !ok && citedOrder != "" {
+		return nil, fmt.Errorf("wrong 'cited-order' value: %s", citedOrder)
+	}
+	dedupMode, ok := gobib.DedupModes[dedup]
+	if !ok {
+		return nil, fmt.Errorf("wrong 'dedup' value: %s", dedup)
+	}
+	conflictPolicy, ok := gobib.ConflictPolicies[conflict]
+	if !ok {
+		return nil, fmt.Errorf("wrong 'dedup-conflict' value: %s", conflict)
+	}
+	keyPolicy, ok := gobib.KeyPolicies[duplicateKeys]
+	if !ok {
+		return nil, fmt.Errorf("wrong 'duplicate-keys' value: %s", duplicateKeys)
+	}
+	titleProtection, ok := gobib.TitleProtections[protection]
+	if !ok {
+		return nil, fmt.Errorf("wrong 'title-protection' value: %s", protection)
+	}
+	caseMode, ok := gobib.TitleCases[titleCase]
+	if !ok {
+		return nil, fmt.Errorf("wrong 'title-case' value: %s", titleCase)
+	}
+	sortOrder, ok := gobib.SortOrders[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("wrong 'sort' value: %s", sortBy)
+	}
+	dateDialect, ok := gobib.Dialects[dialect]
+	if !ok {
+		return nil, fmt.Errorf("wrong 'dialect' value: %s", dialect)
+	}
+	mode, ok := gobib.ResolveModes[resolveMode]
+	if !ok && resolveMode != "" {
+		return nil, fmt.Errorf("wrong 'resolve-mode' value: %s", resolveMode)
+	}
+	resolver, err := newResolver()
+	if err != nil {
+		return nil, err
 	}
 
-	if output != os.Stdout.Name() {
-		outputFile, err = os.OpenFile(output, os.O_WRONLY, 0755)
-		if err != nil {
-			if os.IsNotExist(err) {
-				outputFile, err = os.Create(output)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Fail to create file: %s, %s", output, err.Error())
-					inputFile.Close()
-					os.Exit(-1)
-				}
-			} else {
-				fmt.Fprintf(os.Stderr, "Error opening file %s: %s", output, err.Error())
-				inputFile.Close()
-				os.Exit(-1)
-			}
+	return &gobib.Config{
+		DefaultYear:    year,
+		DefaultVisited: finalDefaultVisited,
+		CitedOrder:     order,
+		Warnings:       os.Stderr,
+		KeyPattern:     keyPattern,
+		Dedup:          dedupMode,
+		Conflict:       conflictPolicy,
+		DuplicateKeys:  keyPolicy,
+		Format: gobib.Format{
+			Protection: titleProtection,
+			Case:       caseMode,
+		},
+		Sort:         sortOrder,
+		Group:        group,
+		Resolver:     resolver,
+		ResolveMode:  mode,
+		ResolvedKeys: libraryKeys,
+		Dialect:      dateDialect,
+	}, nil
+}
+
+// single converts the -in file to the -out one.
+func single() int {
+	config, err := newConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 2
+	}
+
+	if watchInput {
+		if input == os.Stdin.Name() || output == os.Stdout.Name() {
+			fmt.Fprintf(os.Stderr, "Error: -watch needs both -in and -out\n")
+			return 2
 		}
-	} else {
-		outputFile = os.Stdout
+		if err = checkOverwrite(output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			return 2
+		}
+		watch(config)
 	}
 
-	in := bufio.NewReader(inputFile)
-	out := bufio.NewWriter(outputFile)
+	if _, _, err = convert(config, input, output, keymap); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		return 1
+	}
+	if printFinished {
+		fmt.Fprintf(os.Stdout, "Conversion finished\n")
+	}
+	return 0
+}
 
-	config := &gobib.Config{
-		Input:          in,
-		Output:         out,
-		DefaultYear:    year,
-		DefaultVisited: finalDefaultVisited,
+// convert runs a conversion using config, reading the input file,
+// or stdin, and writing to the output file, or stdout, and to the
+// keys file, if any, the changed keys. The output is written only if
+// the conversion succeeds, and replaced at once, so that it's never
+// seen half written. It returns the files read and how many entries
+// were written.
+func convert(config *gobib.Config, input, output, keys string) ([]string, int, error) {
+	inputFile := os.Stdin
+	if input != os.Stdin.Name() {
+		var err error
+		if inputFile, err = os.Open(input); err != nil {
+			return nil, 0, err
+		}
+		defer inputFile.Close()
 	}
 
-	converter := gobib.NewConverter(config)
+	// the config is reused by -watch
+	run := *config
+	if cited != "" {
+		var err error
+		if run.Cited, err = readCitations(cited); err != nil {
+			return nil, 0, fmt.Errorf("reading citations from %s: %w", cited, err)
+		}
+	}
+	var result bytes.Buffer
+	run.Name = input
+	if input == os.Stdin.Name() {
+		run.Name = ""
+	}
+	run.Input = bufio.NewReader(inputFile)
+	run.Output = &result
+	if defaultVisited == "mtime" && run.Name != "" {
+		if info, err := inputFile.Stat(); err == nil {
+			modified := info.ModTime()
+			run.DefaultVisited = &modified
+		}
+	}
+
+	converter := gobib.NewConverter(&run)
 	converter.Convert()
-	okChan, errChan := converter.OkChan(), converter.ErrChan()
-	exit := 0
 	select {
-	case <-okChan:
-		if printFinished {
-			fmt.Fprintf(os.Stdout, "Conversion finished\n")
+	case <-converter.OkChan():
+	case err := <-converter.ErrChan():
+		return nil, 0, err
+	}
+	saveCache()
+
+	var err error
+	if output == os.Stdout.Name() {
+		_, err = os.Stdout.Write(result.Bytes())
+	} else {
+		err = writeOutput(output, result.Bytes())
+	}
+	if err == nil && keys != "" {
+		if err = writeKeyMap(keys, converter.KeyMap()); err != nil {
+			err = fmt.Errorf("writing key map %s: %w", keys, err)
 		}
-	case err = <-errChan:
-		fmt.Fprintf(os.Stderr, "error: %s", err.Error())
-		exit = 1
 	}
-	// closing files and goobye
-	if err = out.Flush(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error in flushing: %s\n", err.Error())
+
+	files := converter.Files()
+	if cited != "" {
+		files = append(files, cited)
 	}
-	inputFile.Close()
-	outputFile.Close()
-	os.Exit(exit)
+	return files, converter.Written(), err
 }
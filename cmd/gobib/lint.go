@@ -0,0 +1,234 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// lint is the 'lint' command: it validates the entries of BibTeX
+// or plain TeX bibliographies, printing the problems found.
+func lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := flags.String("format", "text", "the output format: text, json or sarif")
+	ruleFiles := flags.String("rules", "", "comma separated .toml or .yaml files setting the severity of the rules, or off")
+	minYear := flags.Int("min-year", gobib.DefaultLinter.MinYear, "the year before which the years are suspicious")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib lint [-format=text|json|sarif] file.bib|file.tex...\n")
+		flags.PrintDefaults()
+	}
+	parseFlags("lint", flags, args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "Error in 'format' value: %s\n", *format)
+		return 2
+	}
+
+	rules, err := readRules(*ruleFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the rules: %s\n", err.Error())
+		return 2
+	}
+
+	linter := gobib.Linter{MinYear: *minYear}
+	diagnostics := []gobib.Diagnostic{}
+	for _, name := range flags.Args() {
+		entries, err := readEntries(name)
+		if syntaxError, ok := err.(*gobib.SyntaxError); ok {
+			diagnostics = append(diagnostics, gobib.Diagnostic{
+				Rule:     "syntax",
+				Severity: gobib.SeverityError,
+				Message:  syntaxError.Msg,
+				Source:   gobib.Source{File: syntaxError.File, Line: syntaxError.Line},
+			})
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", name, err.Error())
+			return 1
+		}
+		for _, entry := range entries {
+			diagnostics = append(diagnostics, applyRules(linter.Validate(entry), rules)...)
+		}
+	}
+
+	switch *format {
+	case "text":
+		for _, diagnostic := range diagnostics {
+			fmt.Println(diagnostic)
+		}
+	case "json":
+		err = printJSON(diagnostics)
+	case "sarif":
+		err = printJSON(sarifLog(diagnostics))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the diagnostics: %s\n", err.Error())
+		return 1
+	}
+
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == gobib.SeverityError {
+			return 1
+		}
+	}
+	return 0
+}
+
+// readRules reads the rules files, comma separated, each one
+// setting rules to a severity or to off, like 'unused-field = off'.
+// The later files override the former ones. A rule turned off has
+// no severity in the result.
+func readRules(names string) (map[string]*gobib.Severity, error) {
+	rules := make(map[string]*gobib.Severity)
+	if names == "" {
+		return rules, nil
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		config, err := readConfig(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		for rule, value := range config.sections[""] {
+			if value == "off" {
+				rules[rule] = nil
+				continue
+			}
+			var severity gobib.Severity
+			if err = severity.UnmarshalText([]byte(value)); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", name, rule, err)
+			}
+			rules[rule] = &severity
+		}
+	}
+	return rules, nil
+}
+
+// applyRules changes the severity of the diagnostics as set by
+// the rules, dropping those turned off.
+func applyRules(diagnostics []gobib.Diagnostic, rules map[string]*gobib.Severity) []gobib.Diagnostic {
+	var result []gobib.Diagnostic
+	for _, diagnostic := range diagnostics {
+		severity, ok := rules[diagnostic.Rule]
+		if ok && severity == nil {
+			continue
+		}
+		if ok {
+			diagnostic.Severity = *severity
+		}
+		result = append(result, diagnostic)
+	}
+	return result
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Println(string(content))
+	return err
+}
+
+// sarif is the SARIF 2.1.0 log, with only what lint uses.
+type sarif struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name           string `json:"name"`
+			InformationURI string `json:"informationUri"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifResult struct {
+	RuleID  string `json:"ruleId"`
+	Level   string `json:"level"`
+	Message struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		// Region is nil when the line is unknown, since
+		// startLine can't be 0
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifLevels maps the severities to the SARIF levels.
+var sarifLevels = map[gobib.Severity]string{
+	gobib.SeverityError:   "error",
+	gobib.SeverityWarning: "warning",
+	gobib.SeverityInfo:    "note",
+}
+
+// sarifLog returns the diagnostics as a SARIF log, the format
+// used by code scanning tools to show the problems.
+func sarifLog(diagnostics []gobib.Diagnostic) *sarif {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "gobib"
+	run.Tool.Driver.InformationURI = "https://github.com/nbena/gobib"
+
+	for _, diagnostic := range diagnostics {
+		result := sarifResult{RuleID: diagnostic.Rule, Level: sarifLevels[diagnostic.Severity]}
+		result.Message.Text = diagnostic.Message
+		if diagnostic.Key != "" {
+			result.Message.Text = diagnostic.Key + ": " + diagnostic.Message
+		}
+
+		var location sarifLocation
+		location.PhysicalLocation.ArtifactLocation.URI = diagnostic.Source.File
+		if diagnostic.Source.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: diagnostic.Source.Line}
+		}
+		result.Locations = []sarifLocation{location}
+		run.Results = append(run.Results, result)
+	}
+
+	return &sarif{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+}
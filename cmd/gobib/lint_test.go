@@ -0,0 +1,46 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+func TestSarifLog(t *testing.T) {
+	diagnostics := []gobib.Diagnostic{
+		{Rule: "required-field", Key: "wcf", Message: "@article requires journal", Source: gobib.Source{File: "a.bib", Line: 3}},
+		{Rule: "suspicious-year", Severity: gobib.SeverityWarning, Key: "se", Message: "year 1909 is before 1950", Source: gobib.Source{File: "a.tex"}},
+	}
+	content, err := json.Marshal(sarifLog(diagnostics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(content)
+	for _, expected := range []string{
+		`"ruleId":"required-field","level":"error","message":{"text":"wcf: @article requires journal"},"locations":[{"physicalLocation":{"artifactLocation":{"uri":"a.bib"},"region":{"startLine":3}}}]`,
+		`"ruleId":"suspicious-year","level":"warning","message":{"text":"se: year 1909 is before 1950"},"locations":[{"physicalLocation":{"artifactLocation":{"uri":"a.tex"}}}]`,
+	} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("Expected %s in %s", expected, log)
+		}
+	}
+}
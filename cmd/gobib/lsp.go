@@ -0,0 +1,52 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nbena/gobib/pkg/lsp"
+)
+
+// languageServer is the 'lsp' command: it runs the language
+// server over stdin and stdout. The conversion flags tell how
+// the \bibitem are read.
+func languageServer(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	setEntryFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib lsp [flags]\n")
+		flags.PrintDefaults()
+	}
+	parseFlags("lsp", flags, args)
+
+	config, err := newConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 2
+	}
+
+	server := lsp.New(&lsp.Config{Input: os.Stdin, Output: os.Stdout, Base: *config})
+	if err = server.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,169 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// merge is the 'merge' command: it reads several bibliographies,
+// BibTeX or plain TeX, and writes them as a single BibTeX one.
+func merge(args []string) int {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := flags.String("out", "", "the output file, stdout if not set")
+	dedup := flags.String("dedup", "merge", "what to do with duplicate entries: off, report, keep-first or merge")
+	conflict := flags.String("dedup-conflict", "first", "which value is kept when merging duplicates: first, last or longest")
+	provenance := flags.String("provenance", "", "the JSON file where the file and line of each field are written to")
+	comments := flags.Bool("provenance-comments", false, "precede each entry by a comment telling where its fields come from")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib merge [-out=all.bib] file.bib|file.tex...\n")
+		flags.PrintDefaults()
+	}
+	// the flags may come after the files too
+	var names []string
+	for parseFlags("merge", flags, args); flags.NArg() > 0; flags.Parse(args) {
+		names = append(names, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	dedupMode, ok := gobib.DedupModes[*dedup]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error in 'dedup' value: %s\n", *dedup)
+		return 2
+	}
+	conflictPolicy, ok := gobib.ConflictPolicies[*conflict]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error in 'dedup-conflict' value: %s\n", *conflict)
+		return 2
+	}
+	if len(names) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var entries []*gobib.Entry
+	for _, name := range names {
+		read, err := readEntries(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", name, err.Error())
+			return 1
+		}
+		entries = append(entries, read...)
+	}
+
+	entries, duplicates, changes := gobib.MergeEntries(entries, dedupMode, conflictPolicy)
+	for _, duplicate := range duplicates {
+		fmt.Fprintf(os.Stderr, "warning: %s is a duplicate of %s (%s)\n", duplicate.Key, duplicate.Of, duplicate.Reason)
+	}
+	for _, change := range changes {
+		fmt.Fprintf(os.Stderr, "warning: %s of %s renamed to %s\n", change.Old, change.Source, change.New)
+	}
+
+	var result strings.Builder
+	for _, entry := range entries {
+		if *comments {
+			result.WriteString(provenanceComment(entry))
+		}
+		if isBibTeX(entry.Source.File) {
+			// as they were curated, like fmt does
+			result.WriteString(entry.Formatted(bibFormat) + "\n\n")
+		} else {
+			result.WriteString(entry.String() + "\n\n")
+		}
+	}
+
+	if *out == "" {
+		os.Stdout.WriteString(result.String())
+	} else if err := writeAtomic(*out, []byte(result.String())); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %s\n", *out, err.Error())
+		return 1
+	}
+
+	if *provenance != "" {
+		if err := writeProvenance(*provenance, entries); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing provenance %s: %s\n", *provenance, err.Error())
+			return 1
+		}
+	}
+	return 0
+}
+
+// readEntries reads the entries of a file: a BibTeX one when
+// its extension is .bib, a plain TeX one otherwise.
+func readEntries(name string) ([]*gobib.Entry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if isBibTeX(name) {
+		return gobib.ParseBibTeX(bufio.NewReader(file), name)
+	}
+	return gobib.ReadEntries(&gobib.Config{
+		Input:    bufio.NewReader(file),
+		Name:     name,
+		Warnings: os.Stderr,
+	})
+}
+
+// bibFormat is how the entries read from BibTeX files are
+// written: their titles and values as they are, in braces.
+var bibFormat = gobib.Format{Protection: gobib.ProtectKeep, Braces: true}
+
+// isBibTeX tells if the file name is a BibTeX one, by its extension.
+func isBibTeX(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".bib"
+}
+
+// provenanceComment returns the comment telling where
+// the fields of an entry come from.
+func provenanceComment(entry *gobib.Entry) string {
+	sources := entry.FieldSources()
+	var fields []string
+	for _, field := range entry.FieldNames() {
+		fields = append(fields, field+" "+sources[field].String())
+	}
+	return "% " + strings.Join(fields, ", ") + "\n"
+}
+
+// writeProvenance writes, as JSON, the file and line each
+// field of the entries was read from, by key.
+func writeProvenance(name string, entries []*gobib.Entry) error {
+	provenance := make(map[string]map[string]string)
+	for _, entry := range entries {
+		fields := make(map[string]string)
+		for field, source := range entry.FieldSources() {
+			fields[field] = source.String()
+		}
+		provenance[entry.Key] = fields
+	}
+	content, err := json.MarshalIndent(provenance, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(content, '\n'), 0644)
+}
@@ -0,0 +1,109 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// backupSuffix is added to the name of the output to backup it.
+const backupSuffix = ".bak"
+
+// writeOutput writes data to the output file name. An existing
+// file is overwritten only with -force, -backup or -update: with
+// -backup its previous version is kept, with -update it's replaced
+// only if data is different, so its modification time changes only
+// when needed.
+func writeOutput(name string, data []byte) error {
+	old, err := os.ReadFile(name)
+	switch {
+	case os.IsNotExist(err):
+		return writeAtomic(name, data)
+	case err != nil:
+		return err
+	case update && bytes.Equal(old, data):
+		return nil
+	}
+	if err = checkOverwrite(name); err != nil {
+		return err
+	}
+
+	if backup {
+		if err = writeAtomic(name+backupSuffix, old); err != nil {
+			return fmt.Errorf("writing the backup: %w", err)
+		}
+	}
+	return writeAtomic(name, data)
+}
+
+// checkOverwrite returns an error if the output file name exists
+// and none of -force, -backup and -update is set. -watch checks it
+// before the first conversion, instead of failing at each one.
+func checkOverwrite(name string) error {
+	if _, err := os.Stat(name); err == nil && !force && !backup && !update {
+		return fmt.Errorf("%s exists, use -force to overwrite it", name)
+	}
+	return nil
+}
+
+// writeAtomic writes data to the file name, replacing it at once: data
+// is written to a temporary file in the same directory, synced, then
+// renamed, so that the file is never seen half written, e.g. by latexmk,
+// and a crash leaves either the old or the new version.
+func writeAtomic(name string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(name); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(name)
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	// the temporary file is removed if anything goes wrong
+	defer os.Remove(temp.Name())
+
+	if _, err = temp.Write(data); err == nil {
+		err = temp.Sync()
+	}
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(temp.Name(), mode); err != nil {
+		return err
+	}
+	if err = os.Rename(temp.Name(), name); err != nil {
+		return err
+	}
+
+	// syncing the directory too, so that the rename is on disk,
+	// some systems can't do that and it's not an error
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setTestFlags sets the conversion flags to their defaults,
+// then to args.
+func setTestFlags(t *testing.T, args ...string) {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	setFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of a file, or "" if it doesn't exist.
+func readFile(t *testing.T, name string) string {
+	content, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestWriteOutput(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.bib")
+
+	setTestFlags(t)
+	if err := writeOutput(name, []byte("first")); err != nil {
+		t.Fatalf("Fail to write a new file: %s", err)
+	}
+	if err := writeOutput(name, []byte("second")); err == nil {
+		t.Error("An existing file is overwritten without -force")
+	}
+	gotExpected(readFile(t, name), "first", t)
+
+	setTestFlags(t, "-force")
+	if err := os.Chmod(name, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeOutput(name, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(readFile(t, name), "second", t)
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("The mode isn't kept: %v, %v", info.Mode(), err)
+	}
+	gotExpected(readFile(t, name+backupSuffix), "", t)
+
+	setTestFlags(t, "-backup")
+	if err := writeOutput(name, []byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(readFile(t, name), "third", t)
+	gotExpected(readFile(t, name+backupSuffix), "second", t)
+
+	setTestFlags(t, "-update")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(name, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeOutput(name, []byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(name); !info.ModTime().Equal(past) {
+		t.Error("An unchanged file is written with -update")
+	}
+	if err := writeOutput(name, []byte("fourth")); err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(readFile(t, name), "fourth", t)
+
+	// no temporary file is left behind
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(name), ".out.bib.*"))
+	if len(files) != 0 {
+		t.Errorf("Temporary files left: %v", files)
+	}
+}
+
+func TestWatchExistingOutput(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.tex"), filepath.Join(dir, "out.bib")
+	if err := os.WriteFile(in, []byte("\\begin{thebibliography}{9}\n\\end{thebibliography}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(out, []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// refused before watching, instead of failing at each change
+	setTestFlags(t, "-in", in, "-out", out, "-watch")
+	if status := single(); status != 2 {
+		t.Errorf("Expected status 2, got %d", status)
+	}
+	gotExpected(readFile(t, out), "mine", t)
+
+	setTestFlags(t, "-force")
+	if err := checkOverwrite(out); err != nil {
+		t.Errorf("Unexpected error with -force: %s", err)
+	}
+	setTestFlags(t)
+	if err := checkOverwrite(filepath.Join(dir, "new.bib")); err != nil {
+		t.Errorf("Unexpected error for a new file: %s", err)
+	}
+}
@@ -0,0 +1,97 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// rekey is the 'rekey' command: it rewrites the \cite keys of
+// LaTeX files using the key map written by a conversion.
+func rekey(args []string) int {
+	flags := flag.NewFlagSet("rekey", flag.ExitOnError)
+	keymap := flags.String("keymap", "", "the key map written by the conversion with -keymap")
+	dryRun := flags.Bool("dry-run", false, "print a unified diff instead of writing the files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib rekey -keymap=keys.json [-dry-run] file.tex...\n")
+		flags.PrintDefaults()
+	}
+	parseFlags("rekey", flags, args)
+
+	if *keymap == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	keys, err := readKeyMap(*keymap)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading key map %s: %s\n", *keymap, err.Error())
+		return 1
+	}
+
+	exit := 0
+	for _, name := range flags.Args() {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %s\n", name, err.Error())
+			exit = 1
+			continue
+		}
+
+		rewritten := gobib.RewriteCiteKeys(string(content), keys)
+		if rewritten == string(content) {
+			continue
+		}
+		if *dryRun {
+			fmt.Print(unifiedDiff(name, string(content), rewritten))
+			continue
+		}
+
+		// atomically, so that a crash can't leave the document half written
+		if err := writeAtomic(name, []byte(rewritten)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing file %s: %s\n", name, err.Error())
+			exit = 1
+		}
+	}
+	return exit
+}
+
+// readKeyMap reads a key map written by writeKeyMap.
+func readKeyMap(name string) (map[string]string, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]string
+	err = json.Unmarshal(content, &keys)
+	return keys, err
+}
+
+// writeKeyMap writes a key map as JSON, mapping each old key to the new one.
+func writeKeyMap(name string, keys map[string]string) error {
+	content, err := json.MarshalIndent(keys, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(name, append(content, '\n'))
+}
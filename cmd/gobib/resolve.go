@@ -0,0 +1,132 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nbena/gobib/pkg/gobib"
+	"github.com/nbena/gobib/pkg/resolve"
+	"github.com/nbena/gobib/pkg/zotero"
+)
+
+var (
+	library      string
+	resolveMode  string
+	libraryKeys  bool
+	resolveWith  string
+	crossrefURL  string
+	mailto       string
+	resolveCache string
+	zoteroURL    string
+	// cache is the cache of the resolver, saved after each conversion
+	cache *resolve.Cache
+)
+
+// setResolveFlags defines on flags the flags of the resolvers
+// completing the entries.
+func setResolveFlags(flags *flag.FlagSet) {
+	flags.StringVar(&library, "library", "", "the trusted .bib files, separated by commas, whose entries replace the matching ones")
+	flags.StringVar(&resolveMode, "resolve-mode", "merge", "how the entries found by -library or -resolve are used: merge or substitute")
+	flags.BoolVar(&libraryKeys, "library-keys", false, "use the keys of the -library entries, and the citation keys of the Zotero items")
+	flags.StringVar(&resolveWith, "resolve", "none", "complete the entries with the metadata of, in turn: none, or crossref and zotero separated by commas")
+	flags.StringVar(&crossrefURL, "crossref-url", resolve.DefaultCrossrefURL, "the URL of the Crossref API, or of one compatible with it")
+	flags.StringVar(&mailto, "mailto", "", "the e-mail address sent to Crossref along the requests")
+	flags.StringVar(&resolveCache, "resolve-cache", "", "the JSON file caching the resolved entries (default gobib/crossref.json in the user cache directory)")
+	setZoteroFlags(flags)
+}
+
+// setZoteroFlags defines on flags the flags telling how
+// to reach Zotero.
+func setZoteroFlags(flags *flag.FlagSet) {
+	flags.StringVar(&zoteroURL, "zotero-url", zotero.DefaultURL, "the URL of Zotero, with the Better BibTeX plugin")
+}
+
+// newResolver returns the resolvers set by the flags, if any:
+// the library first, then the -resolve ones in their order.
+func newResolver() (gobib.Resolver, error) {
+	var resolvers gobib.Resolvers
+	if library != "" {
+		var entries []*gobib.Entry
+		for _, name := range strings.Split(library, ",") {
+			read, err := readEntries(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("reading library %s: %w", name, err)
+			}
+			entries = append(entries, read...)
+		}
+		resolvers = append(resolvers, gobib.NewLibrary(entries))
+	}
+
+	for _, name := range strings.Split(resolveWith, ",") {
+		switch strings.TrimSpace(name) {
+		case "", "none":
+		case "crossref":
+			crossref, err := newCrossref()
+			if err != nil {
+				return nil, err
+			}
+			resolvers = append(resolvers, crossref)
+		case "zotero":
+			// Zotero is local, its items aren't cached
+			resolvers = append(resolvers, &zotero.Client{URL: zoteroURL})
+		default:
+			return nil, fmt.Errorf("wrong 'resolve' value: %s", name)
+		}
+	}
+
+	switch len(resolvers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return resolvers[0], nil
+	}
+	return resolvers, nil
+}
+
+// newCrossref returns the Crossref resolver, with its cache.
+func newCrossref() (gobib.Resolver, error) {
+	resolver := &resolve.Crossref{BaseURL: crossrefURL, Mailto: mailto}
+	path := resolveCache
+	if path == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("no cache directory, set -resolve-cache: %w", err)
+		}
+		path = filepath.Join(dir, "gobib", "crossref.json")
+	}
+	var err error
+	if cache, err = resolve.OpenCache(path, resolver); err != nil {
+		return nil, fmt.Errorf("reading the resolver cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// saveCache saves the cache of the resolver, if any.
+func saveCache() {
+	if cache == nil {
+		return
+	}
+	if err := cache.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: saving the resolver cache: %s\n", err.Error())
+	}
+}
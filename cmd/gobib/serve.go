@@ -0,0 +1,88 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/nbena/gobib/pkg/server"
+)
+
+// serve is the 'serve' command: it runs the HTTP conversion
+// service, see package server. The conversion flags are the
+// defaults of the requests.
+func serve(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "the address to listen on")
+	maxBody := flags.Int64("max-body", server.DefaultMaxBodySize, "the maximum size of a request body, in bytes")
+	timeout := flags.Duration("timeout", server.DefaultTimeout, "the maximum duration of a conversion")
+	maxConcurrent := flags.Int("max-concurrent", server.DefaultMaxConcurrent, "how many conversions can run at once")
+	setEntryFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib serve [-addr=:8080] [flags]\n")
+		flags.PrintDefaults()
+	}
+	parseFlags("serve", flags, args)
+
+	config, err := newConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 2
+	}
+
+	httpServer := &http.Server{
+		Addr: *addr,
+		Handler: server.New(&server.Config{
+			Base:          *config,
+			MaxBodySize:   *maxBody,
+			Timeout:       *timeout,
+			MaxConcurrent: *maxConcurrent,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      *timeout + 30*time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	// stopping on ^C, once the running requests are served
+	stopped := make(chan struct{})
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+		close(stopped)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", *addr)
+	if err = httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+	<-stopped
+	return 0
+}
@@ -0,0 +1,84 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround a hunk.
+const diffContext = 3
+
+// unifiedDiff returns the unified diff between old and new, which
+// must have the same number of lines, as the rewrites done by gobib
+// change lines without adding or removing them.
+func unifiedDiff(name, old, new string) string {
+	oldLines := strings.Split(strings.TrimSuffix(old, "\n"), "\n")
+	newLines := strings.Split(strings.TrimSuffix(new, "\n"), "\n")
+	if len(oldLines) != len(newLines) {
+		// not expected, the whole file is replaced
+		return fmt.Sprintf("--- %s\n+++ %s\n@@ -1,%d +1,%d @@\n-%s\n+%s\n", name, name,
+			len(oldLines), len(newLines),
+			strings.Join(oldLines, "\n-"), strings.Join(newLines, "\n+"))
+	}
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", name, name)
+
+	for i := 0; i < len(oldLines); i++ {
+		if oldLines[i] == newLines[i] {
+			continue
+		}
+
+		// a hunk goes on till there are enough unchanged lines
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(oldLines) && j <= end+2*diffContext; j++ {
+			if oldLines[j] != newLines[j] {
+				end = j
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(oldLines) {
+			stop = len(oldLines)
+		}
+
+		fmt.Fprintf(&diff, "@@ -%d,%d +%d,%d @@\n", start+1, stop-start, start+1, stop-start)
+		for j := start; j < stop; j++ {
+			if oldLines[j] == newLines[j] {
+				diff.WriteString(" " + oldLines[j] + "\n")
+				continue
+			}
+			// a run of changed lines: the old ones, then the new ones
+			run := j
+			for ; run < stop && oldLines[run] != newLines[run]; run++ {
+				diff.WriteString("-" + oldLines[run] + "\n")
+			}
+			for ; j < run; j++ {
+				diff.WriteString("+" + newLines[j] + "\n")
+			}
+			j--
+		}
+		i = stop - 1
+	}
+	return diff.String()
+}
@@ -0,0 +1,105 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// pollInterval is how often the watched files are checked.
+const pollInterval = 500 * time.Millisecond
+
+// debounceDelay is how long the files must stay unchanged after a
+// change before converting again, since editors and build tools
+// often write them in bursts.
+const debounceDelay = 300 * time.Millisecond
+
+// fileState is what tells if a watched file changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// statFiles returns the state of each file.
+func statFiles(files []string) map[string]fileState {
+	states := make(map[string]fileState)
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			states[name] = fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+		} else {
+			states[name] = fileState{}
+		}
+	}
+	return states
+}
+
+// changed tells if any file changed between two states.
+func changed(old, new map[string]fileState) bool {
+	for name, state := range new {
+		if old[name] != state {
+			return true
+		}
+	}
+	return false
+}
+
+// watch converts the input whenever it, or one of the files it
+// includes, changes. The files are polled: it's portable and
+// it also works on network file systems. It never returns.
+func watch(config *gobib.Config) {
+	files := []string{input}
+	run := func() {
+		read, _, err := convert(config, input, output, keymap)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+			return
+		}
+		files = read
+		// from now on, the output is ours to overwrite
+		force = true
+		fmt.Fprintf(os.Stderr, "%s %s written\n", time.Now().Format("15:04:05"), filepath.Base(output))
+	}
+
+	run()
+	states := statFiles(files)
+	for {
+		time.Sleep(pollInterval)
+		current := statFiles(files)
+		if !changed(states, current) {
+			continue
+		}
+		// waiting till the burst of writes is over
+		for {
+			time.Sleep(debounceDelay)
+			next := statFiles(files)
+			if !changed(current, next) {
+				break
+			}
+			current = next
+		}
+
+		run()
+		states = statFiles(files)
+	}
+}
@@ -0,0 +1,68 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nbena/gobib/pkg/gobib"
+	"github.com/nbena/gobib/pkg/zotero"
+)
+
+// zoteroImport is the 'zotero' command: it imports bibliographies,
+// BibTeX or plain TeX, into a running Zotero.
+func zoteroImport(args []string) int {
+	flags := flag.NewFlagSet("zotero", flag.ExitOnError)
+	collection := flags.String("collection", "", "the collection the entries are imported into, the one selected in Zotero if not set")
+	setZoteroFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: gobib zotero [-collection=name] file.bib|file.tex...\n")
+		flags.PrintDefaults()
+	}
+	// the flags may come after the files too
+	var names []string
+	for parseFlags("zotero", flags, args); flags.NArg() > 0; flags.Parse(args) {
+		names = append(names, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(names) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var entries []*gobib.Entry
+	for _, name := range names {
+		read, err := readEntries(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", name, err.Error())
+			return 1
+		}
+		entries = append(entries, read...)
+	}
+
+	client := &zotero.Client{URL: zoteroURL}
+	created, err := client.Import(entries, *collection)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error importing into Zotero: %s\n", err.Error())
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "%d items imported\n", created)
+	return 0
+}
@@ -0,0 +1,271 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"io"
+	"strings"
+)
+
+const (
+	// BeginBiblist is the constant: '\begin{biblist}'
+	BeginBiblist = "\\begin{biblist}"
+	// EndBiblist is the constant: '\end{biblist}'
+	EndBiblist = "\\end{biblist}"
+	// Bib is the constant that represents the amsrefs '\bib' command
+	Bib = "\\bib"
+)
+
+// amsrefsTypes maps the amsrefs entry types which have
+// a different name in BibTeX.
+var amsrefsTypes = map[string]string{
+	"webpage": "online",
+}
+
+// amsrefsFields maps the amsrefs fields which have a
+// different name in BibTeX.
+var amsrefsFields = map[string]string{
+	"status": "pubstate",
+}
+
+// braceGroup returns the content of the brace group that starts at
+// s[start], which must be a '{', and the index right after its
+// closing brace. If the group is not closed, ok is false.
+func braceGroup(s string, start int) (content string, end int, ok bool) {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			// skipping escaped braces
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[start+1 : i], i + 1, true
+			}
+		}
+	}
+	return "", len(s), false
+}
+
+// nextBraceGroup skips the spaces from s[start] and returns the
+// brace group that follows, if any.
+func nextBraceGroup(s string, start int) (content string, end int, ok bool) {
+	for start < len(s) && (s[start] == ' ' || s[start] == '\t') {
+		start++
+	}
+	if start >= len(s) || s[start] != '{' {
+		return "", start, false
+	}
+	return braceGroup(s, start)
+}
+
+// cutBib looks for a complete '\bib{key}{type}{fields}' inside s.
+// It returns the item and what comes after it. If there's no
+// complete item, found is false.
+func cutBib(s string) (item dividerResult, rest string, found bool) {
+	start := 0
+	for {
+		index := strings.Index(s[start:], Bib)
+		if index == -1 {
+			return item, s, false
+		}
+		start += index + len(Bib)
+		// \bib*{...} is an amsrefs cross-reference item
+		if start < len(s) && s[start] == '*' {
+			start++
+		}
+		if start < len(s) && (s[start] == '{' || s[start] == ' ') {
+			break
+		}
+	}
+
+	key, end, ok := nextBraceGroup(s, start)
+	if !ok {
+		return item, s, false
+	}
+	bibType, end, ok := nextBraceGroup(s, end)
+	if !ok {
+		return item, s, false
+	}
+	fields, end, ok := nextBraceGroup(s, end)
+	if !ok {
+		return item, s, false
+	}
+
+	item.key = strings.TrimSpace(key)
+	item.bibType = strings.ToLower(strings.TrimSpace(bibType))
+	item.value = fields
+	return item, s[end:], true
+}
+
+// divideAmsrefs is the divider loop for an amsrefs bibliography,
+// it reads till '\end{biblist}'. first is the line that
+// contains '\begin{biblist}'.
+func (c *Tex2BibConverter) divideAmsrefs(first string) error {
+	var buffer strings.Builder
+	buffer.WriteString(first[strings.Index(first, BeginBiblist)+len(BeginBiblist):])
+
+	// start is where the pending item begins
+	start := c.newResult("")
+	for {
+		pending := buffer.String()
+		end := strings.Index(pending, EndBiblist)
+		if end != -1 {
+			pending = pending[:end]
+		}
+
+		// sending every complete item
+		item, rest, found := cutBib(pending)
+		for found {
+			item.source = start.source
+			c.emit(item)
+			item, rest, found = cutBib(rest)
+		}
+		buffer.Reset()
+		buffer.WriteString(rest)
+
+		if end != -1 {
+			return nil
+		}
+
+		line, _, err := c.reader.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				err = ErrBibUnclosed
+			}
+			return err
+		}
+		if !strings.Contains(rest, Bib) {
+			start = c.newResult("")
+		}
+		buffer.WriteByte(' ')
+		buffer.WriteString(strings.TrimSpace(string(line)))
+	}
+}
+
+// keyValue is a single 'name={value}' pair.
+type keyValue struct {
+	name, value string
+}
+
+// splitKeyValues splits a comma-separated list of 'name={value}'
+// or 'name=value' pairs, keeping the order. Commas inside braces
+// don't separate pairs.
+func splitKeyValues(s string) []keyValue {
+	var pairs []keyValue
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				pairs = appendKeyValue(pairs, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return appendKeyValue(pairs, s[start:])
+}
+
+// appendKeyValue parses a single 'name={value}' pair and
+// appends it to pairs. Anything without an '=' is ignored.
+func appendKeyValue(pairs []keyValue, pair string) []keyValue {
+	equal := strings.Index(pair, "=")
+	if equal == -1 {
+		return pairs
+	}
+	value := strings.TrimSpace(pair[equal+1:])
+	if content, end, ok := braceGroup(value, 0); ok && end == len(value) {
+		value = content
+	}
+	return append(pairs, keyValue{
+		name:  strings.ToLower(strings.TrimSpace(pair[:equal])),
+		value: strings.TrimSpace(value),
+	})
+}
+
+// parseAmsrefs converts the fields of an amsrefs item into the
+// fields of an Entry.
+func parseAmsrefs(value string) (authors []string, title string, year int, url string, fields map[string]string) {
+	fields = make(map[string]string)
+	var editors []string
+
+	for _, pair := range splitKeyValues(value) {
+		switch pair.name {
+		case "author":
+			authors = append(authors, pair.value)
+		case "editor":
+			editors = append(editors, pair.value)
+		case "title":
+			title = pair.value
+		case "date", "year":
+			// dates are in the YYYY-MM-DD form
+			date := pair.value
+			if len(date) > 4 {
+				date = date[:4]
+			}
+			year = extractYear(date)
+		case "url":
+			url = pair.value
+		case "review", "label":
+			// MathSciNet reviews and labels have no BibTeX counterpart
+		case "book", "conference":
+			// compound fields: the title is the one of the container
+			for _, inner := range splitKeyValues(pair.value) {
+				name := inner.name
+				if name == "title" {
+					name = "booktitle"
+				}
+				if _, ok := fields[name]; !ok {
+					fields[name] = inner.value
+				}
+			}
+		default:
+			name := pair.name
+			if bibtexName, ok := amsrefsFields[name]; ok {
+				name = bibtexName
+			}
+			fields[name] = pair.value
+		}
+	}
+
+	if len(editors) > 0 {
+		fields["editor"] = strings.Join(editors, " and ")
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+	return
+}
+
+// amsrefsType returns the BibTeX type of an amsrefs entry type.
+func amsrefsType(bibType string) string {
+	if bibtexType, ok := amsrefsTypes[bibType]; ok {
+		return bibtexType
+	}
+	return bibType
+}
@@ -0,0 +1,127 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+const amsrefsBibliography = `
+\begin{bibdiv}
+\begin{biblist}
+
+\bib{wcf}{article}{
+	author={Anderson, Ross},
+	title={Why Cryptosystems Fail},
+	journal={Communications of the ACM},
+	volume={37},
+	date={1994-11},
+	pages={32--40},
+	review={\MR{1234}},
+}
+
+\bib{book}{incollection}{
+	author={One, Author},
+	author={Two, Author},
+	title={A chapter, with a comma},
+	book={
+		title={The Book},
+		publisher={Publisher},
+	},
+	date={2018},
+} \bib{web}{webpage}{title={A page}, url={https://example.com}}
+
+\end{biblist}
+\end{bibdiv}
+`
+
+const expectedAmsrefsBib = `@article{wcf,
+	author = "Anderson, Ross",
+	title = {{Why Cryptosystems Fail}},
+	year = "1994",
+	journal = {Communications of the ACM},
+	pages = {32--40},
+	volume = {37},
+}
+
+@incollection{book,
+	author = "One, Author and Two, Author",
+	title = {{A chapter, with a comma}},
+	year = "2018",
+	booktitle = {The Book},
+	publisher = {Publisher},
+}
+
+@online{web,
+	author = "",
+	title = {{A page}},
+	url = {https://example.com},
+}
+
+`
+
+func TestCutBib(t *testing.T) {
+	item, rest, found := cutBib(`\bibitem{no} \bib{key}{Book}{title={{T}}, author={A}} after`)
+	if !found {
+		t.Fatal("Fail to find the \\bib item")
+	}
+	gotExpected(item.key, "key", false, t)
+	gotExpected(item.bibType, "book", false, t)
+	gotExpected(item.value, "title={{T}}, author={A}", false, t)
+	gotExpected(rest, " after", false, t)
+
+	if _, _, found = cutBib(`\bib{key}{book}{title={`); found {
+		t.Error("Found an incomplete \\bib item")
+	}
+}
+
+func TestSplitKeyValues(t *testing.T) {
+	pairs := splitKeyValues(`Author={B, A}, title={x, {y}}, year=2018,`)
+	expected := []keyValue{{"author", "B, A"}, {"title", "x, {y}"}, {"year", "2018"}}
+	if len(pairs) != len(expected) {
+		t.Fatalf("Mismatch length: %v", pairs)
+	}
+	for i := range pairs {
+		if pairs[i] != expected[i] {
+			t.Errorf("Got: %v, Exp: %v", pairs[i], expected[i])
+		}
+	}
+}
+
+func TestCompleteAmsrefs(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(amsrefsBibliography),
+	}
+	runTestComplete(config, expectedAmsrefsBib, t)
+}
+
+func TestAmsrefsUnclosed(t *testing.T) {
+	var writer strings.Builder
+	converter := initConverter(&Config{
+		Input:  strings.NewReader("\\begin{biblist}\n\\bib{a}{book}{title={T}}\n"),
+		Output: &writer,
+	})
+
+	converter.runDivider()
+	if err := <-converter.Converter.errorChannel; err != ErrBibUnclosed {
+		t.Fatalf("err != ErrBibUnclosed: %v", err)
+	}
+}
@@ -18,11 +18,11 @@
 package gobib
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,6 +34,10 @@ const (
 	EndBibliography = "\\end{thebibliography}"
 	// BibItem is the constant that represents '\bibitem'
 	BibItem = "\\bibitem{"
+
+	// bibitemCommand is \bibitem without the brace, since
+	// it may be followed by a label
+	bibitemCommand = "\\bibitem"
 )
 
 // ErrBibUnclosed is an error that is returned when reading from the
@@ -41,13 +45,18 @@ const (
 var ErrBibUnclosed = errors.New("missing \\end{thebibliography}")
 
 // ErrBibEmpty is an error that is returned when reading from
-// an empty bibliography
+// an empty bibliography, or when neither a \bibitem nor one of
+// the supported lists are found
 var ErrBibEmpty = errors.New("empty bibliography")
 
 // ErrSyntax is an error that is returned when a generic
 // syntax error is encountered
 var ErrSyntax = errors.New("syntax error")
 
+// ErrDuplicateKey is an error that is returned when an entry has
+// the key of a previous one, and the config says it's an error
+var ErrDuplicateKey = errors.New("duplicate key")
+
 // NoDefaultYear should be used when you create a new Config,
 // for saying to not add a default year when a year is not found
 const NoDefaultYear = 0
@@ -70,15 +79,54 @@ type BibtexEntry interface {
 	unclosedToString() string
 }
 
+// Source tells where an entry was read from.
+type Source struct {
+	// File is the name of the file, if known
+	File string
+	// Line is the line where the entry starts
+	Line int
+	// Bibliography is the index, starting from 1, of the
+	// bibliography the entry belongs to, since a document
+	// may have more than one
+	Bibliography int
+}
+
+// String returns the source as 'file:line'.
+func (s Source) String() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
 // Entry is a struct that wraps the basic info
 // about an entry. It is a 'base struct'
 type Entry struct {
+	// Type is the BibTeX entry type, e.g. 'article'.
+	// If empty, 'online' is used.
+	Type    string
 	Key     string
 	Authors []string
 	Title   string
 	Year    int
 	URL     string
 	Visited *time.Time
+	// urldate is the urldate as written in a BibTeX file,
+	// when it's not in ISO 8601 format like 2018-7-6
+	urldate string
+	// Fields holds any other BibTeX field, e.g. 'booktitle',
+	// keyed by its lower case name.
+	Fields map[string]string
+	// Raw holds the values of the fields read from a BibTeX
+	// file which are made of @string macros or joined by '#',
+	// as they're written there, e.g. '"Some " # ieee'. Their
+	// expanded values are in the other fields.
+	Raw map[string]string
+	// Source is where the entry was read from
+	Source Source
+	// Provenance is where the fields taken from other
+	// entries, when merging them, were read from
+	Provenance map[string]Source
+	// Comment is the text preceding the entry in a BibTeX
+	// file, see ParseBibTeXFile
+	Comment string
 }
 
 // NewEntry returns a new Entry.
@@ -102,7 +150,11 @@ func NewEntry(key string, authors []string, title string,
 
 // GenKey generates, sets, returns a new key for this entry.
 func (b *Entry) GenKey() string {
-	key := fmt.Sprintf("%s-%d-%s", b.Title, b.Year, b.Authors[0])
+	author := ""
+	if len(b.Authors) > 0 {
+		author = b.Authors[0]
+	}
+	key := fmt.Sprintf("%s-%d-%s", b.Title, b.FirstYear(), author)
 	b.Key = key
 	return key
 }
@@ -114,31 +166,75 @@ func (b *Entry) AuthorsToString() string {
 }
 
 func (b *Entry) unclosedToString() string {
+	return b.unclosedFormat(Format{})
+}
 
-	result := fmt.Sprintf("@online{%s,\n\tauthor = \"%s\",\n\ttitle = {{%s}},\n", b.Key, b.AuthorsToString(), b.Title)
+// unclosedFormat returns the BibTeX entry written using f,
+// without closing the last bracket.
+func (b *Entry) unclosedFormat(f Format) string {
 
-	if b.Year != emptyYear {
-		result += fmt.Sprintf("\tyear = \"%d\",\n", b.Year)
+	entryType := b.Type
+	if entryType == "" {
+		entryType = "online"
 	}
-	if b.URL != "" {
-		result += "\turl = {" + b.URL + "},\n"
+
+	fields := f.fields(b)
+	width := 0
+	if f.Align {
+		for _, field := range fields {
+			if len(field.name) > width {
+				width = len(field.name)
+			}
+		}
 	}
-	if b.Visited != nil {
-		year, month, day := b.Visited.Date()
-		result += fmt.Sprintf("\turldate = \"%d-%d-%d\",\n", year, month, day)
+	indent := f.Indent
+	if indent == "" {
+		indent = "\t"
+	}
+
+	result := fmt.Sprintf("@%s{%s,\n", entryType, b.Key)
+	for i, field := range fields {
+		result += indent + field.name
+		if width > len(field.name) {
+			result += strings.Repeat(" ", width-len(field.name))
+		}
+		result += " = " + field.value
+		if i < len(fields)-1 || !f.NoTrailingComma {
+			result += ","
+		}
+		result += "\n"
 	}
 	return result
 }
 
+// isProtected tells if s is protected as a whole by braces,
+// like the titles read from BibTeX files usually are.
+func isProtected(s string) bool {
+	if !strings.HasPrefix(s, "{") {
+		return false
+	}
+	_, end, ok := braceGroup(s, 0)
+	return ok && end == len(s)
+}
+
 // String returns a Bibtex-representation of the entry.
 func (b *Entry) String() string {
 	return b.unclosedToString() + "}"
 }
 
+// Formatted returns a Bibtex-representation of the entry written
+// using f. The zero Format gives the same result of String.
+func (b *Entry) Formatted(f Format) string {
+	return b.unclosedFormat(f) + "}"
+}
+
 // Config is the configuration for the converter
 type Config struct {
 	// where to read from
 	Input io.Reader
+	// Name is the name of the file Input reads from, if any. When
+	// set, \input and \include are followed relative to its directory.
+	Name string
 	// where to write to
 	Output io.Writer
 	// DefaultYear is the year to use if not present. If set to 0 it'll be ignored.
@@ -146,28 +242,87 @@ type Config struct {
 	// DefaultVisited is the default 'urldate' value to use.
 	// if set to nil it'll be ignored.
 	DefaultVisited *time.Time
+	// Cited are the keys cited by the document, if not nil only
+	// the cited entries are written, in CitedOrder order.
+	Cited      *Citations
+	CitedOrder CitationOrder
+	// Warnings is where the warnings are written to,
+	// if set to nil they're discarded.
+	Warnings io.Writer
+	// KeyPattern, if not empty, is used to generate the key of
+	// every entry, see Entry.GenKeyFromPattern.
+	KeyPattern string
+	// Dedup tells what to do with the duplicate entries, and
+	// Conflict how to merge them when Dedup is DedupMerge.
+	Dedup    DedupMode
+	Conflict ConflictPolicy
+	// DuplicateKeys tells what to do when two entries have the
+	// same key. Generated keys are always made unique.
+	DuplicateKeys KeyPolicy
+	// Format tells how the entries are written.
+	Format Format
+	// Sort is the order of the entries, they're written in
+	// the input order if SortNone. If Group is true, each
+	// group of entries, e.g. those of the same year when
+	// sorting by year, is preceded by a comment.
+	Sort  SortOrder
+	Group bool
+	// Resolver, if not nil, completes every entry with
+	// authoritative metadata, as ResolveMode says. When
+	// ResolvedKeys is true, the resolved entries having a key,
+	// like those of a Library, take it.
+	Resolver     Resolver
+	ResolveMode  ResolveMode
+	ResolvedKeys bool
+	// Dialect tells how the dates of the items are written,
+	// e.g. 'month = jun' or 'date = {2018-06}'.
+	Dialect Dialect
 }
 
 // Tex2BibConverter is the converter from plain TeX to BibTeX.
 type Tex2BibConverter struct {
-	reader           *bufio.Reader
+	reader           *texReader
 	config           *Config
 	stage1OutChannel chan dividerResult
 	stage2OutChannel chan BibtexEntry
-	errorChannel     chan error
-	okChannel        chan struct{}
+	// errorChannel has a slot for each stage, so that none of them
+	// blocks sending its error after the first one is received
+	errorChannel chan error
+	okChannel    chan struct{}
+
+	// bibliography is the index of the bibliography being divided
+	bibliography int
+	// section is the title of the last section seen by the divider
+	section string
+	// warnMutex serializes the warnings
+	warnMutex sync.Mutex
+	// keyMap maps the changed keys to the new ones
+	keyMap map[string]string
+	// usedKeys are the keys of the entries parsed so far
+	usedKeys map[string]bool
+	// written are the entries written
+	written []*Entry
+	// writeErr is the first error writing the output
+	writeErr error
+	// synchronous is true when the conversion runs without
+	// goroutines, see Run: the divided items are then collected
+	// in items instead of being sent to stage1OutChannel
+	synchronous bool
+	items       []dividerResult
 }
 
 // NewConverter returns a new converter to convert a plain TeX
 // bibliography into a BibTeX one.
 func NewConverter(c *Config) *Tex2BibConverter {
 	return &Tex2BibConverter{
-		reader:           bufio.NewReader(c.Input),
+		reader:           newTexReader(c.Input, c.Name),
 		config:           c,
 		stage1OutChannel: make(chan dividerResult, 10),
 		stage2OutChannel: make(chan BibtexEntry, 10),
-		errorChannel:     make(chan error),
+		errorChannel:     make(chan error, 3),
 		okChannel:        make(chan struct{}, 1),
+		keyMap:           make(map[string]string),
+		usedKeys:         make(map[string]bool),
 	}
 }
 
@@ -183,11 +338,56 @@ func (c *Tex2BibConverter) OkChan() <-chan struct{} {
 	return c.okChannel
 }
 
+// KeyMap returns the keys changed by the conversion, each one
+// mapped to the new key. It should be called once the conversion
+// is finished, the map can be used with RewriteCiteKeys.
+func (c *Tex2BibConverter) KeyMap() map[string]string {
+	return c.keyMap
+}
+
+// Files returns the names of the files read by the conversion:
+// the input, if its name is known, and the included ones, the
+// missing ones too. It should be called once the conversion is
+// finished, e.g. to know what to watch for changes.
+func (c *Tex2BibConverter) Files() []string {
+	var files []string
+	if c.config.Name != "" {
+		files = append(files, c.config.Name)
+	}
+	seen := make(map[string]bool)
+	for _, name := range c.reader.included {
+		if !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// Written returns how many entries were written. It should be
+// called once the conversion is finished.
+func (c *Tex2BibConverter) Written() int {
+	return len(c.written)
+}
+
+// Entries returns the entries written, in the order they were
+// written. It should be called once the conversion is finished.
+func (c *Tex2BibConverter) Entries() []*Entry {
+	return c.written
+}
+
 // what is returned from divider func
 type dividerResult struct {
 	// key is the bibitem key if any
 	// value is the non-parsed TeX entry
 	key, value string
+	// source is where the item starts
+	source Source
+	// bibType is the entry type of an amsrefs \bib item,
+	// it's empty for any other item
+	bibType string
+	// comments are the comments of the item lines
+	comments []string
 }
 
 func (d *dividerResult) String() string {
@@ -195,21 +395,47 @@ func (d *dividerResult) String() string {
 }
 
 func extractKey(line string) (string, error) {
-	if !strings.Contains(line, BibItem) {
+	key, _, ok := cutBibitem(line)
+	if !ok {
 		return "", ErrSyntax
 	}
+	return key, nil
+}
 
-	endIndex := strings.LastIndex(line, "}")
-	if endIndex == -1 {
-		return "", ErrSyntax
-	}
+// hasBibitem tells if line contains a \bibitem.
+func hasBibitem(line string) bool {
+	_, _, ok := cutBibitem(line)
+	return ok
+}
 
-	startIndex := strings.Index(line, "{")
-	if startIndex == -1 {
-		return "", ErrSyntax
+// cutBibitem looks for '\bibitem[label]{key}' inside line, where
+// the label is optional as in the .bbl files created by BibTeX.
+// It returns the key and what follows the \bibitem.
+func cutBibitem(line string) (key, rest string, found bool) {
+	index := strings.Index(line, bibitemCommand)
+	if index == -1 {
+		return "", line, false
+	}
+	start := index + len(bibitemCommand)
+
+	if start < len(line) && line[start] == '[' {
+		// skipping the label, which may contain brackets inside braces
+		depth := 0
+		for start++; start < len(line) && (line[start] != ']' || depth > 0); start++ {
+			if line[start] == '{' {
+				depth++
+			} else if line[start] == '}' {
+				depth--
+			}
+		}
+		start++
 	}
 
-	return line[startIndex+1 : endIndex], nil
+	key, end, ok := nextBraceGroup(line, start)
+	if !ok {
+		return "", line, false
+	}
+	return strings.TrimSpace(key), line[end:], true
 }
 
 // extractURL extract the URL, if any, from a plain TeX
@@ -236,13 +462,11 @@ func extractURL(line string) string {
 	return url
 }
 
+// extractYear returns the year of a token that is a date,
+// see extractDate, or 0.
 func extractYear(line string) int {
-	year := 0
-	fmt.Sscanf(line, "%4d", &year)
-	if !(year != 0 && len(line) <= 6) {
-		year = 0
-	}
-	return year
+	date, _ := extractDate(line)
+	return date.year
 }
 
 // divider take a reader that contains a bibliography and it divides
@@ -252,93 +476,152 @@ func extractYear(line string) int {
 // output is a channel which items will be written to
 // errChan is a channel which errors will be written to
 // When an error occurs, output channel is closed
+// The reader may contain more than one bibliography, e.g. a whole
+// document using chapterbib: they are all divided, one at a time.
 func (c *Tex2BibConverter) divider() {
+	if err := c.divide(); err != nil {
+		c.errorChannel <- err
+	}
+	close(c.stage1OutChannel)
+}
 
-	// entries := list.New()
-	var line []byte
-
-	var key string
-	// var value string
-
-	var readLine string
-	var err error
-
-	bibitemFindLoop := true
-	innerLoop := true
-
-	var currentEntry strings.Builder
-	var currentResult dividerResult
-
-	// FIRST LOOP: till the first \bibitem
-	for bibitemFindLoop {
-
-		line, _, err = c.reader.ReadLine()
+// divide is the divider loop, the items are passed to emit.
+func (c *Tex2BibConverter) divide() error {
+	found := false
 
+	// FIRST LOOP: till the beginning of the next bibliography,
+	// which is then divided by its own loop
+	for {
+		line, _, err := c.reader.ReadLine()
 		if err != nil {
 			if err == io.EOF {
+				if found {
+					return nil
+				}
 				err = ErrBibEmpty
 			}
-			innerLoop = false
-			bibitemFindLoop = false
-			c.errorChannel <- err
-			close(c.stage1OutChannel)
+			return err
 		}
 
-		readLine = string(line)
+		readLine := string(line)
+		c.seeSection(readLine)
+
+		end := c.listEnd(readLine)
+		switch {
+		case hasBibitem(readLine):
+			c.bibliography++
+			err = c.divideBibitems(readLine)
+		case strings.Contains(readLine, BeginBiblist):
+			// amsrefs bibliography
+			c.bibliography++
+			err = c.divideAmsrefs(readLine)
+		case end != "":
+			// \bibitem-less list
+			c.bibliography++
+			err = c.divideList(end)
+		default:
+			continue
+		}
 
-		if strings.Contains(readLine, BibItem) {
-			bibitemFindLoop = false
-			key, _ = extractKey(readLine)
-			currentResult.key = key
+		found = true
+		if err != nil {
+			return err
 		}
 	}
+}
 
-	// SECOND LOOP: till the end of the file
-	for innerLoop {
+// emit passes a divided item to the parser.
+func (c *Tex2BibConverter) emit(item dividerResult) {
+	if c.synchronous {
+		c.items = append(c.items, item)
+	} else {
+		c.stage1OutChannel <- item
+	}
+}
 
-		line, _, err = c.reader.ReadLine()
-		readLine = string(line)
+// newResult returns a new dividerResult for the item that
+// starts in the last line read.
+func (c *Tex2BibConverter) newResult(key string) dividerResult {
+	file, line := c.reader.position()
+	return dividerResult{
+		key: key,
+		source: Source{
+			File:         file,
+			Line:         line,
+			Bibliography: c.bibliography,
+		},
+	}
+}
 
-		if err != nil {
-			// OLD VERSION: treat io.EOF as a non-error but it's wrong because
+// divideBibitems is the divider loop for a thebibliography
+// environment, it reads till '\end{thebibliography}'.
+// first is the line that contains the first \bibitem.
+func (c *Tex2BibConverter) divideBibitems(first string) error {
+	var currentEntry strings.Builder
+	var currentResult dividerResult
+
+	// send pushes the current item to the list
+	// and resets the Builder for holding the next one
+	send := func() {
+		currentResult.value = currentEntry.String()
+		c.emit(currentResult)
+		currentEntry.Reset()
+	}
+
+	readLine := first
+	started := false
+	for {
+		if key, rest, ok := cutBibitem(readLine); ok {
+			// we're at the end of the previous bibitem
+			if started {
+				send()
+			}
+			started = true
+			currentResult = c.newResult(key)
+			readLine = rest
+			c.addComment(&currentResult)
+		} else if index := strings.Index(readLine, EndBibliography); index != -1 {
+			// the bibliography is finished
+			c.writeLine(&currentEntry, readLine[:index])
+			send()
+			return nil
+		}
+
+		// if here, it's just another line of our entry
+		c.writeLine(&currentEntry, readLine)
 
-			// if there's an error we exit from the loop
+		line, _, err := c.reader.ReadLine()
+		if err != nil {
 			if err == io.EOF {
 				err = ErrBibUnclosed
 			}
-			c.errorChannel <- err
-			innerLoop = false
-			currentResult.value = currentEntry.String()
-			c.stage1OutChannel <- currentResult
-			close(c.stage1OutChannel)
+			send()
+			return err
 		}
+		readLine = string(line)
+		if !hasBibitem(readLine) {
+			c.addComment(&currentResult)
+		}
+	}
+}
 
-		if strings.Contains(readLine, BibItem) {
-			// we're at the end of this bibitem
-			// we push the current item to the list
-			// and we reset the Builder for holding the next entry
-			currentResult.value = currentEntry.String()
-
-			c.stage1OutChannel <- currentResult
-			currentEntry.Reset()
+// addComment adds the comment of the last line read, if any,
+// to the comments of an item.
+func (c *Tex2BibConverter) addComment(item *dividerResult) {
+	if comment := strings.TrimSpace(c.reader.lastComment()); comment != "" {
+		item.comments = append(item.comments, comment)
+	}
+}
 
-			// now reading the key
-			key, _ = extractKey(readLine)
-			currentResult.key = key
-		} else if strings.Contains(readLine, EndBibliography) {
-			// the bibliography is finished
-			innerLoop = false
-			currentResult.value = currentEntry.String()
-			c.stage1OutChannel <- currentResult
-			close(c.stage1OutChannel)
-		} else {
-			// if here, it's just another line of our entry
-			// we trim spaces and we write it to the Builder
-			readLine = strings.TrimSpace(readLine)
-			if len(readLine) > 0 {
-				currentEntry.WriteString(readLine)
-			}
+// writeLine trims the spaces from line and writes it
+// to the Builder holding the current entry.
+func (c *Tex2BibConverter) writeLine(entry *strings.Builder, line string) {
+	line = strings.TrimSpace(line)
+	if len(line) > 0 {
+		if entry.Len() > 0 {
+			entry.WriteByte(' ')
 		}
+		entry.WriteString(line)
 	}
 }
 
@@ -346,19 +629,59 @@ func (c *Tex2BibConverter) divider() {
 // and converts them to a BibTextEntry.
 func (c *Tex2BibConverter) parser() {
 	for item := range c.stage1OutChannel {
+		entry, err := c.parse(item)
+		if err != nil {
+			c.errorChannel <- err
+			// letting the divider finish
+			go func() {
+				for range c.stage1OutChannel {
+				}
+			}()
+			break
+		}
+		c.stage2OutChannel <- entry
+	}
+	close(c.stage2OutChannel)
+}
 
-		var entryURL string
-		var entryAuthors []string
-		var entryTitle string
-		var entryYear int
-		var entryVisited *time.Time
-
-		// entryVisited = c.config.DefaultVisited
-
-		tokens := strings.Split(item.value, ",")
+// parse converts a divided item into an Entry.
+func (c *Tex2BibConverter) parse(item dividerResult) (*Entry, error) {
+	var entryURL string
+	var entryAuthors []string
+	var entryTitle string
+	var entryDate itemDate
+	var dated bool
+	var entryVisited *time.Time
+	var entryFields map[string]string
+	var entryType string
+
+	// entryVisited = c.config.DefaultVisited
+
+	// the DOI is removed, so that it's not mistaken for the title
+	value, entryDOI := cutDOI(item.value)
+	// and so is the access date, the comments can tell it too
+	value, entryVisited = cutAccessed(value)
+	if _, commented := cutAccessed(strings.Join(item.comments, " ")); commented != nil {
+		entryVisited = commented
+	}
 
-		// trying to extract the URL and set it
-		entryURL = extractURL(item.value)
+	// trying to extract the URL and set it
+	entryURL = extractURL(value)
+
+	if item.bibType != "" {
+		// amsrefs items are already structured
+		entryType = amsrefsType(item.bibType)
+		entryAuthors, entryTitle, entryDate.year, entryURL, entryFields = parseAmsrefs(item.value)
+		dated = entryDate.year != 0
+	} else if blocks := splitBlocks(value); contentBlocks(blocks) > 1 {
+		// period-separated style, e.g. 'A. Author. Title. In Proc. X, 2019.'
+		entryAuthors, entryTitle, entryDate, dated, entryFields = parseBlocks(blocks)
+		if entryFields["journal"] != "" {
+			entryType = "article"
+		}
+	} else {
+		// the comma of dates like 'June 6, 2018' doesn't split
+		tokens := joinDates(strings.Split(value, ","))
 
 		// determine how many splits we have
 		tokenLen := len(tokens)
@@ -375,8 +698,8 @@ func (c *Tex2BibConverter) parser() {
 			entryAuthors = tokens[0:1]
 			// trying to find out if the year
 			// is the last token
-			entryYear = extractYear(tokens[tokenLen-1])
-			if entryURL == "" && entryYear == 0 {
+			entryDate, dated = extractDate(tokens[tokenLen-1])
+			if entryURL == "" && !dated {
 				// author, author, title
 				entryAuthors = append(entryAuthors, tokens[1])
 				entryTitle = tokens[2]
@@ -396,12 +719,12 @@ func (c *Tex2BibConverter) parser() {
 				titleIndex--
 			}
 			//  searching the year
-			entryYear = extractYear(tokens[tokenLen-1])
-			if entryYear == 0 {
-				entryYear = extractYear(tokens[tokenLen-2])
+			entryDate, dated = extractDate(tokens[tokenLen-1])
+			if !dated {
+				entryDate, dated = extractDate(tokens[tokenLen-2])
 			}
 
-			if entryYear != 0 {
+			if dated {
 				// going back of one position
 				lastAuthorIndex--
 				titleIndex--
@@ -410,64 +733,257 @@ func (c *Tex2BibConverter) parser() {
 			entryAuthors = tokens[:lastAuthorIndex+1]
 			entryTitle = tokens[titleIndex]
 		}
+	}
 
-		// now applying defaults
-		if c.config.DefaultVisited != nil {
-			entryVisited = c.config.DefaultVisited
-		}
-
-		if entryYear == 0 {
-			entryYear = c.config.DefaultYear
+	if entryDOI != "" && entryFields["doi"] == "" {
+		if entryFields == nil {
+			entryFields = make(map[string]string)
 		}
+		entryFields["doi"] = entryDOI
+	}
 
-		entry := &Entry{}
+	// now applying defaults, the urldate is of the URL only
+	if entryVisited == nil {
+		entryVisited = c.config.DefaultVisited
+	}
+	if entryURL == "" {
+		entryVisited = nil
+	}
 
-		//if entryVisited != nil {
-		//	entry.Visited = entryVisited
-		//}
+	// only the items without any date get the default year
+	if !dated {
+		entryDate.year = c.config.DefaultYear
+	}
 
-		entry.Title = strings.TrimSpace(entryTitle)
-		for i, author := range entryAuthors {
-			entryAuthors[i] = strings.TrimSpace(author)
-		}
-		entry.Authors = entryAuthors
-		entry.URL = entryURL
-		entry.Year = entryYear
-		entry.Visited = entryVisited
-
-		key := item.key
-		if key == "" {
-			key = entry.GenKey()
-		}
-		entry.Key = key
+	entry := &Entry{}
 
-		c.stage2OutChannel <- entry
+	//if entryVisited != nil {
+	//	entry.Visited = entryVisited
+	//}
 
+	entry.Title = strings.TrimSpace(entryTitle)
+	for i, author := range entryAuthors {
+		entryAuthors[i] = strings.TrimSpace(author)
 	}
-	close(c.stage2OutChannel)
+	entry.Authors = entryAuthors
+	entry.URL = entryURL
+	entry.Visited = entryVisited
+	entry.Fields = entryFields
+	entry.Type = entryType
+	entry.Source = item.source
+	entry.setDate(entryDate, c.config.Dialect)
+
+	key := item.key
+	if key == "" {
+		key = entry.GenKey()
+	}
+	entry.Key = key
+
+	// resolving first, so that patterns use the canonical data
+	generated, changed := item.key == "", false
+	if resolved := c.resolve(entry); resolved != nil && c.config.ResolvedKeys && resolved.Key != "" {
+		entry.Key = resolved.Key
+		generated, changed = false, true
+	} else if c.config.KeyPattern != "" {
+		// the suffix of years like '2018a' tells apart the works
+		// of the same authors and year
+		entry.GenKeyFromPattern(strings.Replace(c.config.KeyPattern, "{year}", "{year}"+entryDate.suffix, -1))
+		generated, changed = true, true
+	}
+	if err := c.uniqueKey(entry, generated); err != nil {
+		return nil, err
+	}
+	if changed && item.key != "" && item.key != entry.Key {
+		c.keyMap[item.key] = entry.Key
+	}
+	return entry, nil
 }
 
 // Convert starts the conversion into different goroutines and
 // prints result to c.config.Writer.
 // When it's finished, it send an empty struct on c.OkChan().
 // Any error will be sent to c.ErrChan() and will cause the
-/// conversion to immediately finish.
+// conversion to immediately finish.
 func (c *Tex2BibConverter) Convert() {
 	go c.writer()
 	go c.parser()
 	go c.divider()
 }
 
+// Run converts the bibliography like Convert, but without
+// starting any goroutine: it returns once the output is written,
+// or when an error occurs, so it can be used where goroutines
+// can't, or shouldn't, be waited for, e.g. in WebAssembly.
+func (c *Tex2BibConverter) Run() error {
+	entries, err := c.readAll()
+	if err != nil {
+		return err
+	}
+	c.writeAll(entries)
+	return c.writeErr
+}
+
+// readAll divides and parses the whole input, without the
+// pipeline. The entries parsed before an error are returned
+// along with it.
+func (c *Tex2BibConverter) readAll() ([]*Entry, error) {
+	c.synchronous = true
+	divideErr := c.divide()
+
+	var entries []*Entry
+	for _, item := range c.items {
+		entry, err := c.parse(item)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, divideErr
+}
+
+// ReadEntries converts the plain TeX bibliography read from
+// c.Input and returns its entries instead of writing them, so
+// c.Output isn't used. The entries read before an error are
+// returned along with it.
+func ReadEntries(c *Config) ([]*Entry, error) {
+	return NewConverter(c).readAll()
+}
+
 // writer takes input from stage2OutChannel and writes
 // to the internal writer. Errors are returned
 // in c.ErrChan()
+// When only the cited entries are wanted, or they're
+// sorted, they're all held back till the input is finished.
 func (c *Tex2BibConverter) writer() {
-	for bibEntry := range c.stage2OutChannel {
-		_, err := c.config.Output.Write([]byte(bibEntry.String() + "\n\n"))
-		if err != nil {
-			c.errorChannel <- err
+	if c.buffered() {
+		// entries need to be buffered in order to be
+		// filtered, compared to each other and sorted
+		var entries []*Entry
+		for bibEntry := range c.stage2OutChannel {
+			entries = append(entries, bibEntry.(*Entry))
 		}
+		c.writeAll(entries)
+	} else {
+		c.writeBibliographies()
+	}
+	if c.writeErr != nil {
+		c.errorChannel <- c.writeErr
+		return
 	}
 	// when finished, just sending the ok value.
 	c.okChannel <- struct{}{}
 }
+
+// buffered returns whether the entries are written only once
+// they're all parsed.
+func (c *Tex2BibConverter) buffered() bool {
+	return c.config.Cited != nil || c.config.Dedup != DedupOff || c.config.Sort != SortNone
+}
+
+// writeAll writes all the entries at once.
+func (c *Tex2BibConverter) writeAll(entries []*Entry) {
+	entries = c.finish(entries)
+	if c.config.Sort != SortNone && c.config.Group {
+		c.writeGroups(entries)
+	} else {
+		c.writeEntries(entries, c.config.Cited == nil && c.config.Sort == SortNone)
+	}
+}
+
+// finish applies to the buffered entries the passes
+// that need all of them.
+func (c *Tex2BibConverter) finish(entries []*Entry) []*Entry {
+	if c.config.Dedup != DedupOff {
+		entries = c.dedup(entries)
+	}
+	if c.config.Cited != nil {
+		entries = c.cited(entries)
+	}
+	SortEntries(entries, c.config.Sort)
+	return entries
+}
+
+// writeEntries writes the buffered entries. If headers is
+// true, each bibliography but the first is preceded by a
+// comment telling where it comes from, like they're streamed
+// by writeBibliographies.
+func (c *Tex2BibConverter) writeEntries(entries []*Entry, headers bool) {
+	last := 0
+	for _, entry := range entries {
+		if headers && last != 0 && entry.Source.Bibliography != last {
+			c.writeHeader(entry.Source)
+		}
+		last = entry.Source.Bibliography
+		c.writeEntry(entry)
+	}
+}
+
+// writeBibliographies writes the entries as soon as they're
+// received from stage2OutChannel. When the input has more than
+// one bibliography, each one but the first is preceded by a
+// comment telling where it comes from, written when its first
+// entry arrives: whether there are others isn't known while
+// the first one is written.
+func (c *Tex2BibConverter) writeBibliographies() {
+	last := 0
+	for bibEntry := range c.stage2OutChannel {
+		source := entrySource(bibEntry)
+		if last != 0 && source.Bibliography != last {
+			c.writeHeader(source)
+		}
+		last = source.Bibliography
+		c.writeEntry(bibEntry)
+	}
+}
+
+// write writes s to the output. After an error nothing else
+// is written, the error is returned by the writer.
+func (c *Tex2BibConverter) write(s string) {
+	if c.writeErr != nil {
+		return
+	}
+	_, c.writeErr = c.config.Output.Write([]byte(s))
+}
+
+// warnf writes a warning to c.config.Warnings, if any.
+func (c *Tex2BibConverter) warnf(format string, args ...interface{}) {
+	if c.config.Warnings == nil {
+		return
+	}
+	c.warnMutex.Lock()
+	defer c.warnMutex.Unlock()
+	fmt.Fprintf(c.config.Warnings, "warning: "+format+"\n", args...)
+}
+
+// writeHeader writes the comment that precedes a bibliography.
+func (c *Tex2BibConverter) writeHeader(source Source) {
+	header := fmt.Sprintf("%% bibliography %d", source.Bibliography)
+	if source.File != "" {
+		header += " (" + source.File + ")"
+	}
+	c.write(header + "\n\n")
+}
+
+// writeEntry writes an entry followed by an empty line.
+func (c *Tex2BibConverter) writeEntry(bibEntry BibtexEntry) {
+	c.write(c.entryString(bibEntry) + "\n\n")
+	if entry, ok := bibEntry.(*Entry); ok {
+		c.written = append(c.written, entry)
+	}
+}
+
+// entryString returns an entry written using the config format.
+func (c *Tex2BibConverter) entryString(bibEntry BibtexEntry) string {
+	if entry, ok := bibEntry.(*Entry); ok {
+		return entry.Formatted(c.config.Format)
+	}
+	return bibEntry.String()
+}
+
+// entrySource returns where an entry was read from.
+func entrySource(bibEntry BibtexEntry) Source {
+	if entry, ok := bibEntry.(*Entry); ok {
+		return entry.Source
+	}
+	return Source{}
+}
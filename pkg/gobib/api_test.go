@@ -18,6 +18,9 @@
 package gobib
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"strings"
 	"testing"
 	"time"
@@ -101,14 +104,12 @@ const expectedBibWithVisited = `@online{wcf,
 	author = "Ross Anderson",
 	title = {{Why Cryptosystems Don't Fail}},
 	year = "2010",
-	urldate = "2018-7-6",
 }
 
 @online{aass,
 	author = "Asking Alexandria",
 	title = {{Someone Somewhere}},
 	year = "2011",
-	urldate = "2018-7-6",
 }
 
 `
@@ -211,7 +212,7 @@ func TestDividerOk(t *testing.T) {
 			if entriesLen == expectedLen {
 				loop = false
 			}
-			t.Logf(entry.String())
+			t.Log(entry.String())
 		case err = <-converter.Converter.errorChannel:
 			loop = false
 		}
@@ -241,7 +242,34 @@ func TestDividerNoEnd(t *testing.T) {
 	if err == nil {
 		t.Fatalf("error is nil")
 	} else if err != ErrBibUnclosed {
-		t.Fatalf("err != ErrBibUnclosed" + err.Error())
+		t.Fatal("err != ErrBibUnclosed" + err.Error())
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	var writer strings.Builder
+	converter := initConverter(&Config{
+		Input:         strings.NewReader("\\begin{thebibliography}{9}\n\\bibitem{a} A, Title\n\\bibitem{a} B, Title\n"),
+		Output:        &writer,
+		DuplicateKeys: KeysError,
+	})
+
+	// both the parser and the divider fail, neither must
+	// block sending its error while nobody is receiving
+	done := make(chan struct{})
+	go func() {
+		converter.Converter.parser()
+		done <- struct{}{}
+	}()
+	go func() {
+		converter.Converter.divider()
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	errs := []error{<-converter.Converter.errorChannel, <-converter.Converter.errorChannel}
+	if errs[0] != ErrBibUnclosed && errs[1] != ErrBibUnclosed {
+		t.Errorf("Expected ErrBibUnclosed, got %v", errs)
 	}
 }
 
@@ -258,7 +286,7 @@ func TestEmptyDivider(t *testing.T) {
 	if err == nil {
 		t.Fatalf("error is nil")
 	} else if err != ErrBibEmpty {
-		t.Fatalf("err != ErrBibEmpty: " + err.Error())
+		t.Fatal("err != ErrBibEmpty: " + err.Error())
 	}
 }
 
@@ -289,6 +317,38 @@ func TestExtractEmptyURL(t *testing.T) {
 	gotExpected(got, expected, false, t)
 }
 
+func TestConvertStreams(t *testing.T) {
+	input, inputWriter := io.Pipe()
+	output, outputWriter := io.Pipe()
+	converter := NewConverter(&Config{Input: input, Output: outputWriter})
+	converter.Convert()
+
+	// the first entry is written once the second one begins,
+	// before the input is finished
+	go io.WriteString(inputWriter, "\\begin{thebibliography}{9}\n\\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail\n\\bibitem{se}\n")
+	expected := "@online{wcf,\n\tauthor = \"Ross Anderson\",\n\ttitle = {{Why Cryptosystems Fail}},\n}\n\n"
+	timer := time.AfterFunc(5*time.Second, func() {
+		output.CloseWithError(errors.New("nothing written before the end of the input"))
+	})
+	got := make([]byte, len(expected))
+	if _, err := io.ReadFull(output, got); err != nil {
+		t.Fatal(err)
+	}
+	timer.Stop()
+	gotExpected(string(got), expected, false, t)
+
+	go func() {
+		io.WriteString(inputWriter, "Ross Anderson, Security Engineering\n\\end{thebibliography}\n")
+		inputWriter.Close()
+	}()
+	go io.Copy(io.Discard, output)
+	select {
+	case <-converter.OkChan():
+	case err := <-converter.ErrChan():
+		t.Fatal(err)
+	}
+}
+
 func TestParser(t *testing.T) {
 	config := &Config{
 		Input:       strings.NewReader(bib),
@@ -306,13 +366,13 @@ func TestParser(t *testing.T) {
 	for loop {
 		select {
 		case err := <-converter.Converter.errorChannel:
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 			loop = false
 		case bibEntry, ok := <-converter.Converter.stage2OutChannel:
 			if !ok {
 				loop = false
 			} else {
-				t.Logf(bibEntry.String())
+				t.Log(bibEntry.String())
 				if !ExtendedBibtexEntryEqual(bibEntry.(*Entry), &bibResult[i]) {
 					t.Errorf("Fail to check: %s %s", bibEntry.String(), bibResult[i].String())
 				}
@@ -323,6 +383,17 @@ func TestParser(t *testing.T) {
 }
 
 func runTestComplete(c *Config, expectedOutput string, t *testing.T) {
+	// the same conversion, without goroutines
+	input, _ := io.ReadAll(c.Input)
+	c.Input = bytes.NewReader(input)
+	var synchronous strings.Builder
+	config := *c
+	config.Input, config.Output, config.Warnings = bytes.NewReader(input), &synchronous, nil
+	if err := NewConverter(&config).Run(); err != nil {
+		t.Errorf("Fail to run: %s", err)
+	}
+	gotExpected(synchronous.String(), expectedOutput, false, t)
+
 	// var writer strings.Builder
 	converter := initConverter(c)
 	writer := c.Output.(*strings.Builder)
@@ -0,0 +1,436 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SyntaxError is returned when a BibTeX file can't be parsed.
+type SyntaxError struct {
+	// File is the name of the file, if known
+	File string
+	// Line is where the error is
+	Line int
+	// Msg tells what's wrong
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// bibtexParser is the state of the parsing of a BibTeX file.
+type bibtexParser struct {
+	input  string
+	pos    int
+	line   int
+	name   string
+	macros map[string]string
+}
+
+// BibTeXFile is a parsed BibTeX file.
+type BibTeXFile struct {
+	// Preamble is the text preceding all the entries, not
+	// belonging to any of them, see Sort
+	Preamble string
+	// Entries are the entries, in order
+	Entries []*Entry
+	// Trailer is the text following the last entry
+	Trailer string
+}
+
+// Sort sorts the entries of the file. Since the @string macros
+// must be defined before they're used, the comments of the
+// entries, with the @string, @preamble and @comment items, are
+// moved to the Preamble first, in the order they're found.
+func (f *BibTeXFile) Sort(order SortOrder) {
+	if order == SortNone {
+		return
+	}
+	var preamble []string
+	if f.Preamble != "" {
+		preamble = append(preamble, f.Preamble)
+	}
+	for _, entry := range f.Entries {
+		if entry.Comment != "" {
+			preamble = append(preamble, entry.Comment)
+			entry.Comment = ""
+		}
+	}
+	f.Preamble = strings.Join(preamble, "\n\n")
+	SortEntries(f.Entries, order)
+}
+
+// ParseBibTeX reads a BibTeX file and returns its entries. name is
+// the name of the file r reads from, used for the entries Source,
+// and it may be empty. @string macros are expanded, though the
+// values made of them are kept as written in Raw, @comment and
+// @preamble are skipped, and so is any text outside the entries.
+func ParseBibTeX(r io.Reader, name string) ([]*Entry, error) {
+	file, err := ParseBibTeXFile(r, name)
+	if file == nil {
+		return nil, err
+	}
+	return file.Entries, err
+}
+
+// ParseBibTeXFile is like ParseBibTeX, but it also keeps the text
+// outside the entries: what precedes an entry, like comments and
+// the @comment, @preamble and @string items, is its Comment.
+func ParseBibTeXFile(r io.Reader, name string) (*BibTeXFile, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &bibtexParser{
+		input:  string(input),
+		line:   1,
+		name:   name,
+		macros: make(map[string]string),
+	}
+
+	file := &BibTeXFile{}
+	text := 0
+	for p.skipTo('@') {
+		at := p.pos - 1
+		entry, err := p.parseItem()
+		if err != nil {
+			return file, err
+		}
+		if entry != nil {
+			entry.Comment = strings.TrimSpace(p.input[text:at])
+			file.Entries = append(file.Entries, entry)
+			text = p.pos
+		}
+	}
+	file.Trailer = strings.TrimSpace(p.input[text:])
+	return file, nil
+}
+
+// errorf returns a SyntaxError at the current position.
+func (p *bibtexParser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{File: p.name, Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next moves to the next char, counting lines.
+func (p *bibtexParser) next() {
+	if p.input[p.pos] == '\n' {
+		p.line++
+	}
+	p.pos++
+}
+
+// skipTo moves right after the next c, it returns false at the end.
+func (p *bibtexParser) skipTo(c byte) bool {
+	for p.pos < len(p.input) {
+		found := p.input[p.pos] == c
+		p.next()
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// skipSpaces moves to the next char that is not a space.
+func (p *bibtexParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.next()
+	}
+}
+
+// peek returns the current char, or 0 at the end.
+func (p *bibtexParser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// identifier reads a name, like an entry type, a field or a macro.
+func (p *bibtexParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune(" \t\r\n{}(),=#\"%", rune(p.input[p.pos])) {
+		p.next()
+	}
+	return p.input[start:p.pos]
+}
+
+// group reads a brace group, p.pos must be on the '{'. It returns its content.
+func (p *bibtexParser) group() (string, error) {
+	line := p.line
+	start := p.pos + 1
+	depth := 0
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.next()
+				return p.input[start : p.pos-1], nil
+			}
+		}
+		p.next()
+	}
+	p.line = line
+	return "", p.errorf("unbalanced braces")
+}
+
+// quoted reads a quoted value, p.pos must be on the '"'. It returns its content.
+func (p *bibtexParser) quoted() (string, error) {
+	line := p.line
+	p.next()
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			if depth == 0 {
+				p.next()
+				return p.input[start : p.pos-1], nil
+			}
+		}
+		p.next()
+	}
+	p.line = line
+	return "", p.errorf("unterminated quoted value")
+}
+
+// value reads a field value, which may be made of several
+// parts joined by '#'. It returns the value with the macros
+// expanded and, if it's made of macros or of several parts,
+// the value as it's written, with its parts joined by ' # '.
+func (p *bibtexParser) value() (string, string, error) {
+	var value strings.Builder
+	var parts []string
+	raw := false
+	for {
+		p.skipSpaces()
+		start := p.pos
+		switch c := p.peek(); {
+		case c == '{':
+			part, err := p.group()
+			if err != nil {
+				return "", "", err
+			}
+			value.WriteString(part)
+		case c == '"':
+			part, err := p.quoted()
+			if err != nil {
+				return "", "", err
+			}
+			value.WriteString(part)
+		case c != 0:
+			name := p.identifier()
+			if name == "" {
+				return "", "", p.errorf("missing value")
+			}
+			if _, err := strconv.Atoi(name); err != nil {
+				raw = true
+			}
+			if macro, ok := p.macros[strings.ToLower(name)]; ok {
+				value.WriteString(macro)
+			} else {
+				// numbers, and undefined macros like 'jan'
+				value.WriteString(name)
+			}
+		default:
+			return "", "", p.errorf("missing value")
+		}
+		parts = append(parts, p.input[start:p.pos])
+
+		p.skipSpaces()
+		if p.peek() != '#' {
+			if !raw && len(parts) == 1 {
+				return value.String(), "", nil
+			}
+			return value.String(), strings.Join(parts, " # "), nil
+		}
+		p.next()
+	}
+}
+
+// fields reads the 'name = value' list of an item till closing.
+// raw are the values made of macros as they're written, by field.
+func (p *bibtexParser) fields(closing byte) (fields []keyValue, raw map[string]string, err error) {
+	for {
+		p.skipSpaces()
+		switch p.peek() {
+		case ',':
+			p.next()
+			continue
+		case closing:
+			p.next()
+			return fields, raw, nil
+		case 0:
+			return fields, raw, p.errorf("missing '%c'", closing)
+		}
+
+		name := strings.ToLower(p.identifier())
+		p.skipSpaces()
+		if name == "" || p.peek() != '=' {
+			return fields, raw, p.errorf("expected a field, found '%c'", p.peek())
+		}
+		p.next()
+		value, written, err := p.value()
+		if err != nil {
+			return fields, raw, err
+		}
+		fields = append(fields, keyValue{name: name, value: value})
+		if written != "" {
+			if raw == nil {
+				raw = make(map[string]string)
+			}
+			raw[name] = written
+		}
+	}
+}
+
+// parseItem parses what follows a '@'. It returns nil
+// for the items that are not entries.
+func (p *bibtexParser) parseItem() (*Entry, error) {
+	line := p.line
+	itemType := strings.ToLower(p.identifier())
+	p.skipSpaces()
+
+	var closing byte
+	switch p.peek() {
+	case '{':
+		closing = '}'
+	case '(':
+		closing = ')'
+	default:
+		// a '@' outside an entry, e.g. in an email address
+		return nil, nil
+	}
+
+	switch itemType {
+	case "comment", "preamble":
+		if closing == '}' {
+			_, err := p.group()
+			return nil, err
+		}
+		if !p.skipTo(closing) {
+			return nil, p.errorf("missing '%c'", closing)
+		}
+		return nil, nil
+	case "string":
+		p.next()
+		macros, _, err := p.fields(closing)
+		for _, macro := range macros {
+			p.macros[macro.name] = macro.value
+		}
+		return nil, err
+	}
+
+	p.next()
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] != ',' && p.input[p.pos] != closing {
+		p.next()
+	}
+	key := strings.TrimSpace(p.input[start:p.pos])
+
+	fields, raw, err := p.fields(closing)
+	if err != nil {
+		return nil, err
+	}
+	entry := entryFromFields(itemType, key, fields)
+	entry.Raw = raw
+	entry.Source = Source{File: p.name, Line: line, Bibliography: 1}
+	return entry, nil
+}
+
+// entryFromFields returns the Entry having the given BibTeX fields.
+func entryFromFields(entryType, key string, fields []keyValue) *Entry {
+	entry := &Entry{Type: entryType, Key: key}
+	for _, field := range fields {
+		value := strings.TrimSpace(field.value)
+		switch field.name {
+		case "author":
+			entry.Authors = SplitNames(value)
+			continue
+		case "title":
+			entry.Title = value
+			continue
+		case "year":
+			if year, err := strconv.Atoi(value); err == nil {
+				entry.Year = year
+				continue
+			}
+		case "url":
+			entry.URL = value
+			continue
+		case "urldate":
+			if visited, err := time.Parse("2006-1-2", value); err == nil {
+				entry.Visited = &visited
+				if !isoDateRegexp.MatchString(value) {
+					// for lint, Visited can't tell
+					entry.urldate = value
+				}
+				continue
+			}
+		}
+
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[field.name] = value
+	}
+	return entry
+}
+
+// SplitNames splits a BibTeX list of names, joined by 'and'.
+// An 'and' inside braces doesn't separate two names.
+func SplitNames(names string) []string {
+	var result []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(names); i++ {
+		switch names[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ' ', '\t', '\n':
+			if depth == 0 && strings.HasPrefix(strings.ToLower(names[i+1:]), "and") &&
+				i+4 < len(names) && unicode.IsSpace(rune(names[i+4])) {
+				result = append(result, strings.TrimSpace(names[start:i]))
+				start = i + 4
+				i += 3
+			}
+		}
+	}
+	if last := strings.TrimSpace(names[start:]); last != "" {
+		result = append(result, last)
+	}
+	return result
+}
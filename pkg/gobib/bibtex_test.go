@@ -0,0 +1,147 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const bibtexFile = `Text outside the entries, like foo@example.com, is ignored.
+@string{acm = "ACM Press"}
+@comment{@article{commented, title = {No}}}
+@preamble{"\newcommand{\noop}[1]{}"}
+
+@Article{wcf,
+  author = {Ross Anderson and {Barnes and Noble}},
+  title = {{Why Cryptosystems Fail}},
+  year = 1994,
+  publisher = acm # { NY},
+  month = jan,
+  urldate = "2018-7-6",
+}
+
+@misc(other, title="Other {Thing}", year="in press")
+`
+
+func TestParseBibTeX(t *testing.T) {
+	entries, err := ParseBibTeX(strings.NewReader(bibtexFile), "a.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	wcf := entries[0]
+	gotExpected(wcf.Type, "article", false, t)
+	gotExpected(wcf.Key, "wcf", false, t)
+	gotExpected(strings.Join(wcf.Authors, "|"), "Ross Anderson|{Barnes and Noble}", false, t)
+	gotExpected(wcf.Title, "{Why Cryptosystems Fail}", false, t)
+	gotExpected(wcf.Fields["publisher"], "ACM Press NY", false, t)
+	gotExpected(wcf.Fields["month"], "jan", false, t)
+	gotExpected(wcf.Raw["publisher"], "acm # { NY}", false, t)
+	gotExpected(wcf.Raw["month"], "jan", false, t)
+	if _, ok := wcf.Raw["year"]; ok {
+		t.Errorf("Expected no raw year, got %s", wcf.Raw["year"])
+	}
+	gotExpected(wcf.Source.String(), "a.bib:6", false, t)
+	if wcf.Year != 1994 {
+		t.Errorf("Expected year 1994, got %d", wcf.Year)
+	}
+	if wcf.Visited == nil || wcf.Visited.Format("2006-01-02") != "2018-07-06" {
+		t.Errorf("Wrong urldate: %v", wcf.Visited)
+	}
+
+	other := entries[1]
+	gotExpected(other.Title, "Other {Thing}", false, t)
+	gotExpected(other.Fields["year"], "in press", false, t)
+	gotExpected(other.Source.String(), "a.bib:15", false, t)
+}
+
+func TestParseBibTeXRoundTrip(t *testing.T) {
+	var writer strings.Builder
+	defaultTime, _ := time.Parse("2006-01-02", "2018-07-06")
+	config := &Config{
+		Output:         &writer,
+		Input:          strings.NewReader(bib),
+		DefaultYear:    2010,
+		DefaultVisited: &defaultTime,
+	}
+	runTestComplete(config, expectedBibWithVisited, t)
+
+	entries, err := ParseBibTeX(strings.NewReader(writer.String()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written strings.Builder
+	for _, entry := range entries {
+		written.WriteString(entry.String() + "\n\n")
+	}
+	gotExpected(written.String(), expectedBibWithVisited, false, t)
+}
+
+func TestBibTeXFileSort(t *testing.T) {
+	input := `% my papers
+
+@string{ieee = "IEEE Press"}
+@article{zz, publisher = ieee, title = {Last}}
+
+@article{aa, publisher = ieee, title = {First}}
+`
+	file, err := ParseBibTeXFile(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Sort(SortKey)
+	gotExpected(file.Preamble, "% my papers\n\n@string{ieee = \"IEEE Press\"}", false, t)
+	gotExpected(file.Entries[0].Key+" "+file.Entries[1].Key, "aa zz", false, t)
+	for _, entry := range file.Entries {
+		gotExpected(entry.Comment, "", false, t)
+		gotExpected(entry.Fields["publisher"], "IEEE Press", false, t)
+	}
+
+	file, _ = ParseBibTeXFile(strings.NewReader(input), "")
+	file.Sort(SortNone)
+	gotExpected(file.Preamble, "", false, t)
+	gotExpected(file.Entries[0].Comment, "% my papers\n\n@string{ieee = \"IEEE Press\"}", false, t)
+}
+
+func TestParseBibTeXError(t *testing.T) {
+	_, err := ParseBibTeX(strings.NewReader("@article{key,\n  title = {Unclosed,\n  year = 2018\n"), "a.bib")
+	syntaxError, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("Expected a SyntaxError, got %v", err)
+	}
+	if syntaxError.Line != 2 {
+		t.Errorf("Expected the error at line 2, got %s", syntaxError)
+	}
+}
+
+func TestSplitNames(t *testing.T) {
+	tests := map[string]string{
+		"A and B":                "A|B",
+		"A AND B and {C and D}":  "A|B|{C and D}",
+		"Anderson, Ross and Bob": "Anderson, Ross|Bob",
+		"Sandy Band":             "Sandy Band",
+	}
+	for names, expected := range tests {
+		gotExpected(strings.Join(SplitNames(names), "|"), expected, false, t)
+	}
+}
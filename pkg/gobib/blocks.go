@@ -0,0 +1,302 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NewBlock is the constant that represents '\newblock'
+const NewBlock = "\\newblock"
+
+// abbreviations are the words that are usually followed by
+// a period without ending a block, e.g. 'In Proc. X'.
+var abbreviations = map[string]bool{
+	"proc": true, "vol": true, "no": true, "nr": true, "pp": true,
+	"p": true, "ch": true, "sec": true, "conf": true, "int": true,
+	"intl": true, "symp": true, "trans": true, "j": true, "jr": true,
+	"sr": true, "dr": true, "mr": true, "mrs": true, "ms": true,
+	"st": true, "ed": true, "eds": true, "inc": true, "ltd": true,
+	"co": true, "vs": true, "cf": true, "univ": true, "dept": true,
+	"tech": true, "rep": true, "jan": true, "feb": true, "mar": true,
+	"apr": true, "jun": true, "jul": true, "aug": true, "sep": true,
+	"sept": true, "oct": true, "nov": true, "dec": true,
+}
+
+// blockYearRegexp matches a plausible publication year inside a block.
+var blockYearRegexp = regexp.MustCompile(`(^|[^0-9])((1[5-9]|20)[0-9]{2})([^0-9]|$)`)
+
+// authorsSepRegexp matches the 'and', or '&', between two authors.
+var authorsSepRegexp = regexp.MustCompile(`,?\s+(?:and|\\?&)\s+`)
+
+// authorsDateRegexp matches the date following the authors in the
+// author-year styles, like 'Smith, J. (2019)' or 'Smith, J. 2019',
+// and what follows it in the same block, e.g. the title in Harvard.
+var authorsDateRegexp = regexp.MustCompile(`^(.*?)[\s,]*(?:\(([^()]*)\)|\s([12][0-9]{3}[a-z]?))[.,:]?(?:\s+(.*))?$`)
+
+// journalRegexp matches a journal with its volume, issue and
+// pages, like 'Journal of Stuff, 3(2), 1-10'.
+var journalRegexp = regexp.MustCompile(`^(.+?),\s*(?:[Vv]ol\.\s*)?([0-9]+)\s*(?:\(([0-9]+(?:[-–][0-9]+)?)\))?\s*[,:]\s*(?:pp?\.\s*)?([0-9]+)(?:\s*(?:-+|–)\s*([0-9]+))?$`)
+
+// splitBlocks divides a plain TeX bib entry into blocks, using
+// '\newblock' and the periods that end a sentence as separators.
+// A period does not end a block when it follows an initial or a
+// well known abbreviation, when it's inside braces, or when the
+// next word starts with a lower case letter.
+func splitBlocks(value string) []string {
+	var blocks []string
+	for _, part := range strings.Split(value, NewBlock) {
+		blocks = append(blocks, splitSentences(part)...)
+	}
+
+	result := blocks[:0]
+	for _, block := range blocks {
+		block = strings.TrimSpace(block)
+		block = strings.TrimSpace(strings.TrimSuffix(block, "."))
+		if block != "" {
+			result = append(result, block)
+		}
+	}
+	return result
+}
+
+// splitSentences splits a single part of an entry at the periods
+// that end a sentence.
+func splitSentences(value string) []string {
+	var sentences []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case '.', '?', '!':
+			if depth == 0 && endsSentence(value, i) {
+				end := i
+				if value[i] != '.' {
+					// keeping '?' and '!' since they're part of the title
+					end++
+				}
+				sentences = append(sentences, value[start:end])
+				start = i + 1
+			}
+		}
+	}
+	return append(sentences, value[start:])
+}
+
+// endsSentence tells if the punctuation at index i of value
+// ends a sentence.
+func endsSentence(value string, i int) bool {
+	next := strings.TrimLeft(value[i+1:], " \t")
+	if len(next) == len(value[i+1:]) {
+		// no space after: it's an URL, a number or something like that
+		return next == ""
+	}
+	if next == "" {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(next)
+	if unicode.IsLower(r) {
+		return false
+	}
+	if value[i] != '.' {
+		return true
+	}
+
+	word := value[:i]
+	if index := strings.LastIndexAny(word, " \t~("); index != -1 {
+		word = word[index+1:]
+	}
+	return !isInitial(word) && !abbreviations[strings.ToLower(word)]
+}
+
+// isInitial tells if word is an initial like 'A', 'J.-P' or 'A.B'.
+func isInitial(word string) bool {
+	if word == "" {
+		return false
+	}
+	for _, part := range strings.FieldsFunc(word, func(r rune) bool {
+		return r == '.' || r == '-'
+	}) {
+		if utf8.RuneCountInString(part) > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// isURLBlock tells if a block contains just an URL.
+func isURLBlock(block string) bool {
+	return strings.HasPrefix(block, "\\url{") && strings.HasSuffix(block, "}")
+}
+
+// contentBlocks returns how many blocks carry something other
+// than an URL or a date.
+func contentBlocks(blocks []string) int {
+	n := 0
+	for _, block := range blocks {
+		if _, dated := extractDate(block); !isURLBlock(block) && !dated {
+			n++
+		}
+	}
+	return n
+}
+
+// extractBlockYear looks for a year inside a block. It returns
+// the year and what remains of the block once the year is removed.
+func extractBlockYear(block string) (int, string) {
+	matches := blockYearRegexp.FindAllStringSubmatchIndex(block, -1)
+	if matches == nil {
+		return 0, block
+	}
+	last := matches[len(matches)-1]
+	year, _ := strconv.Atoi(block[last[4]:last[5]])
+
+	rest := block[:last[4]] + block[last[5]:]
+	rest = strings.Replace(rest, "()", "", 1)
+	rest = strings.Trim(rest, " ,;:")
+	return year, rest
+}
+
+// cutAuthorsDate removes the date following the authors in the
+// author-year styles from the authors block, returning it and
+// what follows it in the block, if anything.
+func cutAuthorsDate(block string) (string, itemDate, bool, string) {
+	match := authorsDateRegexp.FindStringSubmatch(block)
+	if match == nil || match[1] == "" {
+		return block, itemDate{}, false, ""
+	}
+	date, ok := extractDate(match[2] + match[3])
+	if !ok {
+		return block, itemDate{}, false, ""
+	}
+	return match[1], date, true, match[4]
+}
+
+// areInitials tells if s is made of initials only, like 'J. K.'.
+func areInitials(s string) bool {
+	words := strings.Fields(strings.Replace(s, ".", ". ", -1))
+	for _, word := range words {
+		if !isInitial(strings.TrimSuffix(word, ".")) {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// splitAuthors splits the authors block of an entry, which may
+// use both commas and 'and' as separators. In a list like
+// 'Smith, J., Doe, A.' the commas separate the surnames from
+// the initials too, so they're taken two at a time.
+func splitAuthors(block string) []string {
+	var authors []string
+	for _, part := range authorsSepRegexp.Split(block, -1) {
+		names := strings.Split(part, ",")
+		paired := len(names)%2 == 0
+		for i := 1; i < len(names) && paired; i += 2 {
+			paired = areInitials(names[i])
+		}
+		if paired {
+			for i := 0; i < len(names); i += 2 {
+				authors = append(authors, strings.TrimSpace(names[i])+", "+strings.TrimSpace(names[i+1]))
+			}
+			continue
+		}
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				authors = append(authors, name)
+			}
+		}
+	}
+	return authors
+}
+
+// parseBlocks assigns a role to each block of an entry: the first
+// block contains the authors, and the date in the author-year
+// styles, the second one the title, the others may contain the
+// venue, the date and the URL. dated tells if the date is found.
+func parseBlocks(blocks []string) (authors []string, title string, date itemDate, dated bool, fields map[string]string) {
+	authorsBlock, date, dated, rest := cutAuthorsDate(blocks[0])
+	if rest != "" {
+		// the title follows the date in the same block
+		blocks = append([]string{authorsBlock, rest}, blocks[1:]...)
+	}
+	authors = splitAuthors(authorsBlock)
+
+	i := 1
+	for ; i < len(blocks) && title == ""; i++ {
+		if !isURLBlock(blocks[i]) {
+			title = blocks[i]
+		}
+	}
+
+	var notes []string
+	for ; i < len(blocks); i++ {
+		block := blocks[i]
+		if isURLBlock(block) {
+			continue
+		}
+		if blockDate, ok := extractDate(block); ok {
+			date, dated = blockDate, true
+			continue
+		}
+		blockYear, rest := extractBlockYear(block)
+		if blockYear != 0 {
+			date, dated = itemDate{year: blockYear}, true
+		}
+		if strings.Contains(rest, "\\url{") || rest == "" {
+			continue
+		}
+
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		match := journalRegexp.FindStringSubmatch(rest)
+		switch {
+		case match != nil && fields["journal"] == "":
+			fields["journal"], fields["volume"] = match[1], match[2]
+			if match[3] != "" {
+				fields["number"] = match[3]
+			}
+			fields["pages"] = match[4]
+			if match[5] != "" {
+				fields["pages"] += "--" + match[5]
+			}
+		case strings.HasPrefix(rest, "In ") && fields["booktitle"] == "":
+			fields["booktitle"] = strings.TrimSpace(strings.TrimPrefix(rest, "In "))
+		case fields["howpublished"] == "" && fields["booktitle"] == "" && fields["journal"] == "":
+			fields["howpublished"] = rest
+		default:
+			notes = append(notes, rest)
+		}
+	}
+	if len(notes) > 0 {
+		fields["note"] = strings.Join(notes, ". ")
+	}
+	return
+}
@@ -0,0 +1,189 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+const periodBibliography = `
+\begin{thebibliography}{10}
+	\bibitem{ab}
+	A. Author and B. Author.
+	\newblock Title of paper.
+	\newblock In Proc. X, 2019.
+
+	\bibitem{jp}
+	J.-P. Someone, Another Person, and C. Third. Why cryptosystems fail. Communications of the ACM, 1994. \url{example.com/wcf}
+
+	\bibitem{wcf}
+	Ross Anderson, Why Cryptosystems Fail, 1909, \url{example.com/ra/wcf.pdf}
+\end{thebibliography}
+`
+
+const expectedPeriodBib = `@online{ab,
+	author = "A. Author and B. Author",
+	title = {{Title of paper}},
+	year = "2019",
+	booktitle = {Proc. X},
+}
+
+@online{jp,
+	author = "J.-P. Someone and Another Person and C. Third",
+	title = {{Why cryptosystems fail}},
+	year = "1994",
+	url = {example.com/wcf},
+	howpublished = {Communications of the ACM},
+}
+
+@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1909",
+	url = {example.com/ra/wcf.pdf},
+}
+
+`
+
+func TestSplitBlocks(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{
+			"A. Author and B. Author. Title of paper. In Proc. X, 2019.",
+			[]string{"A. Author and B. Author", "Title of paper", "In Proc. X, 2019"},
+		},
+		{
+			"A. Author. \\newblock Is it? \\newblock {Some T. Book}, 2018",
+			[]string{"A. Author", "Is it?", "{Some T. Book}, 2018"},
+		},
+		{
+			"F. Bar, Advanced Topics in Advanced Topics, 2018",
+			[]string{"F. Bar, Advanced Topics in Advanced Topics, 2018"},
+		},
+		{
+			"Ross Anderson, Why Cryptosystems Fail, 1909, \\url{example.com/ra/wcf.pdf}",
+			[]string{"Ross Anderson, Why Cryptosystems Fail, 1909, \\url{example.com/ra/wcf.pdf}"},
+		},
+	}
+
+	for _, test := range tests {
+		got := splitBlocks(test.value)
+		gotExpected(strings.Join(got, "|"), strings.Join(test.expected, "|"), false, t)
+	}
+}
+
+func TestSplitAuthors(t *testing.T) {
+	tests := map[string]string{
+		"A. Author and B. Author":             "A. Author|B. Author",
+		"A. One, B. Two, and C. Three":        "A. One|B. Two|C. Three",
+		"Author, A.":                          "Author, A.",
+		"Author, A. and Other, B.":            "Author, A.|Other, B.",
+		"Ross Anderson, Asking Alexandria":    "Ross Anderson|Asking Alexandria",
+		"Someone Important and Nobody Really": "Someone Important|Nobody Really",
+		"Smith, J., and Doe, A.":              "Smith, J.|Doe, A.",
+		"Smith, J., Doe, A. B., \\& Roe, R.":  "Smith, J.|Doe, A. B.|Roe, R.",
+	}
+	for value, expected := range tests {
+		gotExpected(strings.Join(splitAuthors(value), "|"), expected, false, t)
+	}
+}
+
+func TestCutAuthorsDate(t *testing.T) {
+	tests := []struct {
+		block, authors string
+		year           int
+		rest           string
+	}{
+		{"Smith, J. (2019)", "Smith, J.", 2019, ""},
+		{"Smith, J. and Doe, A. (2018a) Title of the thing", "Smith, J. and Doe, A.", 2018, "Title of the thing"},
+		{"Smith, J. 2019", "Smith, J.", 2019, ""},
+		{"A. Author (Ed.)", "A. Author (Ed.)", 0, ""},
+		{"A. Author and B. Author", "A. Author and B. Author", 0, ""},
+	}
+	for _, test := range tests {
+		authors, date, _, rest := cutAuthorsDate(test.block)
+		gotExpected(authors, test.authors, false, t)
+		gotExpected(rest, test.rest, false, t)
+		if date.year != test.year {
+			t.Errorf("%s: expected year %d, got %d", test.block, test.year, date.year)
+		}
+	}
+}
+
+func TestExtractBlockYear(t *testing.T) {
+	year, rest := extractBlockYear("In Proc. X (2019)")
+	if year != 2019 {
+		t.Errorf("Fail to extract year, got: %d", year)
+	}
+	gotExpected(rest, "In Proc. X", false, t)
+
+	year, rest = extractBlockYear("Springer")
+	if year != 0 {
+		t.Errorf("Unexpected year: %d", year)
+	}
+	gotExpected(rest, "Springer", false, t)
+}
+
+func TestCompletePeriodSeparated(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(periodBibliography),
+	}
+	runTestComplete(config, expectedPeriodBib, t)
+}
+
+const authorYearBibliography = `
+\begin{thebibliography}{9}
+\bibitem{apa} Smith, J., \& Doe, A. B. (2019). A study of things. Journal of Stuff, 3(2), 1-10.
+\bibitem{harvard} Smith, J. and Doe, A. (2018) Title of the thing. Journal of Stuff, 4, pp. 11-20.
+\end{thebibliography}
+`
+
+const expectedAuthorYearBib = `@article{apa,
+	author = "Smith, J. and Doe, A. B.",
+	title = {{A study of things}},
+	year = "2019",
+	journal = {Journal of Stuff},
+	number = {2},
+	pages = {1--10},
+	volume = {3},
+}
+
+@article{harvard,
+	author = "Smith, J. and Doe, A.",
+	title = {{Title of the thing}},
+	year = "2018",
+	journal = {Journal of Stuff},
+	pages = {11--20},
+	volume = {4},
+}
+
+`
+
+func TestCompleteAuthorYear(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(authorYearBibliography),
+	}
+	runTestComplete(config, expectedAuthorYearBib, t)
+}
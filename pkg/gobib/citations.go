@@ -0,0 +1,165 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CitationOrder is the order of the entries
+// when only the cited ones are written.
+type CitationOrder int
+
+const (
+	// OrderCitation writes the entries in the order
+	// they're first cited.
+	OrderCitation CitationOrder = iota
+	// OrderAlphabetical writes the entries sorted by key.
+	OrderAlphabetical
+)
+
+// CitationOrders are the orders by name.
+var CitationOrders = map[string]CitationOrder{
+	"citation":     OrderCitation,
+	"alphabetical": OrderAlphabetical,
+}
+
+// citeRegexp matches the citation commands of LaTeX, natbib and
+// biblatex, and the '\citation' written in the .aux files.
+// The keys are in the last group.
+var citeRegexp = regexp.MustCompile(`\\(?:nocite|citation|[Cc]ite(?:p|t|alt|alp|author|year|yearpar|num|title|date|url)?|[Pp]arencite|[Tt]extcite|[Aa]utocite|[Ff]ootcite|[Ss]martcite|supercite|fullcite|footfullcite)\*?\s*(?:\[[^\]]*\]\s*){0,2}\{([^}]*)\}`)
+
+// Citations are the keys cited by a document.
+type Citations struct {
+	// Keys are the cited keys, in the order they're first cited
+	Keys []string
+	// All is true when the document uses '\nocite{*}'
+	All bool
+}
+
+// ExtractCitations reads a LaTeX document, or the .aux file created
+// when compiling it, and returns the keys it cites. name is the name
+// of the file r reads from, it's used to follow \input and \include
+// and it may be empty.
+func ExtractCitations(r io.Reader, name string) (*Citations, error) {
+	citations := &Citations{}
+	seen := make(map[string]bool)
+
+	reader := newTexReader(r, name)
+	for {
+		line, _, err := reader.ReadLine()
+		if err == io.EOF {
+			return citations, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range citeRegexp.FindAllStringSubmatch(string(line), -1) {
+			for _, key := range strings.Split(match[1], ",") {
+				key = strings.TrimSpace(key)
+				if key == "*" {
+					citations.All = true
+				} else if key != "" && !seen[key] {
+					seen[key] = true
+					citations.Keys = append(citations.Keys, key)
+				}
+			}
+		}
+	}
+}
+
+// RewriteCiteKeys replaces the keys cited by a LaTeX document
+// using keys, which maps each old key to the new one. Nothing
+// outside the arguments of the citation commands is changed.
+func RewriteCiteKeys(document string, keys map[string]string) string {
+	var result strings.Builder
+	last := 0
+	for _, match := range citeRegexp.FindAllStringSubmatchIndex(document, -1) {
+		result.WriteString(document[last:match[2]])
+
+		cited := strings.Split(document[match[2]:match[3]], ",")
+		for i, key := range cited {
+			// keeping the spaces around the key
+			trimmed := strings.TrimSpace(key)
+			if newKey, ok := keys[trimmed]; ok && trimmed != "" {
+				cited[i] = strings.Replace(key, trimmed, newKey, 1)
+			}
+		}
+		result.WriteString(strings.Join(cited, ","))
+		last = match[3]
+	}
+	result.WriteString(document[last:])
+	return result.String()
+}
+
+// cited returns only the cited entries, in the order given
+// by the config. It warns about the cited keys without an
+// entry, and about the entries never cited. The cited keys
+// are looked for in the key map too, since they may have
+// been changed by the conversion.
+func (c *Tex2BibConverter) cited(entries []*Entry) []*Entry {
+	citations := c.config.Cited
+
+	byKey := make(map[string]*Entry)
+	for _, entry := range entries {
+		if _, ok := byKey[entry.Key]; !ok {
+			byKey[entry.Key] = entry
+		}
+	}
+
+	var result []*Entry
+	isCited := make(map[string]bool)
+	for _, key := range citations.Keys {
+		entry, ok := byKey[key]
+		if !ok {
+			entry, ok = byKey[c.keyMap[key]]
+		}
+		if !ok {
+			c.warnf("%s is cited but there's no bibitem for it", key)
+			continue
+		}
+		if !isCited[entry.Key] {
+			isCited[entry.Key] = true
+			result = append(result, entry)
+		}
+	}
+
+	for _, entry := range entries {
+		if isCited[entry.Key] {
+			continue
+		}
+		if citations.All {
+			// \nocite{*}: the others come after the cited ones
+			isCited[entry.Key] = true
+			result = append(result, entry)
+		} else {
+			c.warnf("%s is never cited", entry.Key)
+		}
+	}
+
+	if c.config.CitedOrder == OrderAlphabetical {
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].Key < result[j].Key
+		})
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+const citingDocument = `
+As shown in \citep[see][p.~2]{aass, wcf} and \citet*{missing},
+% \cite{commented}
+\textcite{wcf}. \citetext{not a key} \bibcite{neither}
+`
+
+const auxFile = `\relax
+\citation{wcdf}
+\citation{aass,wcf}
+\bibcite{wcf}{1}
+\citation{*}
+`
+
+const expectedCitedBib = `@online{aass,
+	author = "Asking Alexandria",
+	title = {{Someone Somewhere}},
+	year = "2011",
+}
+
+@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1909",
+	url = {example.com/ra/wcf.pdf},
+}
+
+`
+
+const expectedCitedWarnings = `warning: missing is cited but there's no bibitem for it
+warning: wcdf is never cited
+`
+
+func TestExtractCitations(t *testing.T) {
+	citations, err := ExtractCitations(strings.NewReader(citingDocument), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(strings.Join(citations.Keys, ","), "aass,wcf,missing", false, t)
+	if citations.All {
+		t.Error("All is set without \\nocite{*}")
+	}
+
+	citations, err = ExtractCitations(strings.NewReader(auxFile), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(strings.Join(citations.Keys, ","), "wcdf,aass,wcf", false, t)
+	if !citations.All {
+		t.Error("All is not set with \\nocite{*}")
+	}
+}
+
+func TestCompleteCited(t *testing.T) {
+	citations, _ := ExtractCitations(strings.NewReader(citingDocument), "")
+
+	var writer, warnings strings.Builder
+	config := &Config{
+		Output:   &writer,
+		Input:    strings.NewReader(bib),
+		Cited:    citations,
+		Warnings: &warnings,
+	}
+	runTestComplete(config, expectedCitedBib, t)
+	gotExpected(warnings.String(), expectedCitedWarnings, false, t)
+}
+
+func TestCompleteCitedAlphabetical(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output:     &writer,
+		Input:      strings.NewReader(bib),
+		Cited:      &Citations{Keys: []string{"wcf"}, All: true},
+		CitedOrder: OrderAlphabetical,
+	}
+	converter := initConverter(config)
+	converter.Converter.Convert()
+	<-converter.Converter.OkChan()
+
+	keys := []string{}
+	for _, line := range strings.Split(writer.String(), "\n") {
+		if strings.HasPrefix(line, "@") {
+			keys = append(keys, line)
+		}
+	}
+	gotExpected(strings.Join(keys, " "), "@online{aass, @online{wcdf, @online{wcf,", false, t)
+}
+
+func TestRewriteCiteKeys(t *testing.T) {
+	document := "See \\citep[p.~2]{wcf, aass} and wcf. \\nocite{*}\n% \\cite{wcf}\n\\label{wcf}"
+	expected := "See \\citep[p.~2]{anderson1994, aass} and wcf. \\nocite{*}\n% \\cite{anderson1994}\n\\label{wcf}"
+	got := RewriteCiteKeys(document, map[string]string{"wcf": "anderson1994"})
+	gotExpected(got, expected, false, t)
+}
@@ -0,0 +1,224 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the flavour of BibTeX the entries are written in,
+// which tells how their dates are written.
+type Dialect int
+
+const (
+	// DialectBibTeX writes the dates as year, month and day,
+	// e.g. 'month = jun', and a range as 'year = {2017--2018}'.
+	DialectBibTeX Dialect = iota
+	// DialectBibLaTeX writes the dates more precise than a year,
+	// and the ranges, as an ISO date, e.g. 'date = {2018-06}'.
+	DialectBibLaTeX
+)
+
+// Dialects are the dialects by name.
+var Dialects = map[string]Dialect{
+	"bibtex":   DialectBibTeX,
+	"biblatex": DialectBibLaTeX,
+}
+
+// itemDate is the date of an item, as written in it.
+type itemDate struct {
+	year, endYear, month, day int
+	// suffix is the letter telling apart the works of the same
+	// authors and year, like the 'a' of '2018a'
+	suffix string
+	// pubstate is the publication state of the works not
+	// published yet, 'inpress' or 'forthcoming'
+	pubstate string
+}
+
+var (
+	// yearRegexp matches a year, with the suffix that may follow it.
+	yearRegexp = regexp.MustCompile(`^([12][0-9]{3})([a-z])?$`)
+	// rangeRegexp matches a range of years, like '2017--2018'.
+	rangeRegexp = regexp.MustCompile(`^([12][0-9]{3})\s*(?:-{1,3}|–|—|/)\s*([12][0-9]{3})$`)
+	// isoRegexp matches a date like '2018-06' or '2018-06-06'.
+	isoRegexp = regexp.MustCompile(`^([12][0-9]{3})-([0-9]{2})(?:-([0-9]{2}))?$`)
+	// monthRegexp matches a date like 'June 2018', 'June 6, 2018'
+	// or '6 Jun. 2018a'.
+	monthRegexp = regexp.MustCompile(`^(?:([0-9]{1,2})\s+)?([a-z]+)\.?\s+(?:([0-9]{1,2}),?\s+)?([12][0-9]{3})([a-z])?$`)
+	// monthDayRegexp matches the part of a date like 'June 6, 2018'
+	// before the comma.
+	monthDayRegexp = regexp.MustCompile(`(?i)^\s*[a-z]+\.?\s+[0-9]{1,2}\s*$`)
+)
+
+// pubstates are the publication states, by how they're written.
+var pubstates = map[string]string{
+	"in press":    "inpress",
+	"forthcoming": "forthcoming",
+	"to appear":   "forthcoming",
+}
+
+// extractDate tells if a token of an item, as a whole, is a date:
+// a year, maybe followed by a letter like '2018a', a month and a
+// year, maybe with the day, like 'June 6, 2018', an ISO date, a
+// range of years like '2017--2018', 'in press', 'forthcoming' or
+// 'n.d.'. The parentheses or brackets around it are ignored.
+func extractDate(token string) (itemDate, bool) {
+	var date itemDate
+	token = strings.ToLower(strings.TrimSpace(token))
+	token = strings.TrimSpace(strings.TrimRight(token, ".;"))
+	if len(token) > 1 && strings.ContainsAny(token[:1], "([") && strings.ContainsAny(token[len(token)-1:], ")]") {
+		token = strings.TrimSpace(strings.TrimRight(token[1:len(token)-1], "."))
+	}
+	token = strings.Join(strings.Fields(token), " ")
+
+	if pubstate, ok := pubstates[token]; ok {
+		date.pubstate = pubstate
+		return date, true
+	}
+	if token == "n.d" || token == "n. d" || token == "nd" || token == "no date" {
+		// a date, though an empty one
+		return date, true
+	}
+
+	if match := yearRegexp.FindStringSubmatch(token); match != nil {
+		date.year, _ = strconv.Atoi(match[1])
+		date.suffix = match[2]
+		return date, true
+	}
+	if match := rangeRegexp.FindStringSubmatch(token); match != nil {
+		date.year, _ = strconv.Atoi(match[1])
+		date.endYear, _ = strconv.Atoi(match[2])
+		if date.endYear <= date.year {
+			return itemDate{}, false
+		}
+		return date, true
+	}
+	if match := isoRegexp.FindStringSubmatch(token); match != nil {
+		date.year, _ = strconv.Atoi(match[1])
+		date.month, _ = strconv.Atoi(match[2])
+		date.day, _ = strconv.Atoi(match[3])
+		if !date.valid() {
+			return itemDate{}, false
+		}
+		return date, true
+	}
+	if match := monthRegexp.FindStringSubmatch(token); match != nil {
+		macro, ok := months[match[2]]
+		if !ok || (match[1] != "" && match[3] != "") {
+			return itemDate{}, false
+		}
+		date.month = monthNumbers[macro]
+		day := match[1] + match[3]
+		date.day, _ = strconv.Atoi(day)
+		date.year, _ = strconv.Atoi(match[4])
+		date.suffix = match[5]
+		if !date.valid() {
+			return itemDate{}, false
+		}
+		return date, true
+	}
+	return itemDate{}, false
+}
+
+// valid tells if the month and the day of a date make sense.
+func (d itemDate) valid() bool {
+	return d.month >= 0 && d.month <= 12 && d.day >= 0 && d.day <= 31 && (d.day == 0 || d.month != 0)
+}
+
+// joinDates joins the tokens of an item split by the comma
+// of a date like 'June 6, 2018'.
+func joinDates(tokens []string) []string {
+	for i := 0; i+1 < len(tokens); i++ {
+		if !monthDayRegexp.MatchString(tokens[i]) {
+			continue
+		}
+		if date, ok := extractDate(tokens[i] + "," + tokens[i+1]); ok && date.month != 0 {
+			tokens[i] += "," + tokens[i+1]
+			tokens = append(tokens[:i+1], tokens[i+2:]...)
+		}
+	}
+	return tokens
+}
+
+// setDate sets the date of an entry, writing it as dialect says.
+func (b *Entry) setDate(date itemDate, dialect Dialect) {
+	setField := func(name, value string) {
+		if b.Fields == nil {
+			b.Fields = make(map[string]string)
+		}
+		b.Fields[name] = value
+	}
+
+	if date.pubstate != "" {
+		setField("pubstate", date.pubstate)
+	}
+	switch {
+	case date.year == 0:
+	case dialect == DialectBibLaTeX && date.endYear != 0:
+		setField("date", fmt.Sprintf("%d/%d", date.year, date.endYear))
+	case dialect == DialectBibLaTeX && date.day != 0:
+		setField("date", fmt.Sprintf("%d-%02d-%02d", date.year, date.month, date.day))
+	case dialect == DialectBibLaTeX && date.month != 0:
+		setField("date", fmt.Sprintf("%d-%02d", date.year, date.month))
+	case date.endYear != 0:
+		// as a BibTeX file with such a year is read
+		setField("year", fmt.Sprintf("%d--%d", date.year, date.endYear))
+	default:
+		b.Year = date.year
+		if date.month != 0 {
+			setField("month", monthMacros[date.month-1])
+		}
+		if date.day != 0 {
+			setField("day", strconv.Itoa(date.day))
+		}
+	}
+}
+
+// FirstYear returns the year of the entry or, when it's
+// written as a date or as a range, its first year.
+func (b *Entry) FirstYear() int {
+	if b.Year != emptyYear {
+		return b.Year
+	}
+	for _, field := range []string{"date", "year"} {
+		if value := b.Fields[field]; len(value) >= 4 {
+			if year, err := strconv.Atoi(value[:4]); err == nil {
+				return year
+			}
+		}
+	}
+	return emptyYear
+}
+
+// copyYear sets the year of the entry to that of src, either a
+// year or a range: the one the entry had, whichever it was, is
+// replaced, so that it never has both.
+func (b *Entry) copyYear(src *Entry) {
+	b.Year = src.Year
+	delete(b.Fields, "year")
+	if src.Year == emptyYear && src.Fields["year"] != emptyString {
+		if b.Fields == nil {
+			b.Fields = make(map[string]string)
+		}
+		b.Fields["year"] = src.Fields["year"]
+	}
+}
@@ -0,0 +1,205 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractDate(t *testing.T) {
+	tests := []struct {
+		token string
+		date  itemDate
+		ok    bool
+	}{
+		{"2018", itemDate{year: 2018}, true},
+		{" (2018a).", itemDate{year: 2018, suffix: "a"}, true},
+		{"June 2018", itemDate{year: 2018, month: 6}, true},
+		{"June 6, 2018", itemDate{year: 2018, month: 6, day: 6}, true},
+		{"6 Jun. 2018b", itemDate{year: 2018, month: 6, day: 6, suffix: "b"}, true},
+		{"2018-06-06", itemDate{year: 2018, month: 6, day: 6}, true},
+		{"2017--2018", itemDate{year: 2017, endYear: 2018}, true},
+		{"[In press]", itemDate{pubstate: "inpress"}, true},
+		{"to appear", itemDate{pubstate: "forthcoming"}, true},
+		{"n.d.", itemDate{}, true},
+		{"2018--2017", itemDate{}, false},
+		{"2018-13", itemDate{}, false},
+		{"Foo 2018", itemDate{}, false},
+		{"Security Engineering", itemDate{}, false},
+	}
+	for _, test := range tests {
+		date, ok := extractDate(test.token)
+		if ok != test.ok || date != test.date {
+			t.Errorf("%q: expected %+v %v, got %+v %v", test.token, test.date, test.ok, date, ok)
+		}
+	}
+}
+
+func TestJoinDates(t *testing.T) {
+	tokens := joinDates(strings.Split("Ross Anderson, Title, June 6, 2018, Page 6, 7", ","))
+	gotExpected(strings.Join(tokens, "|"), "Ross Anderson| Title| June 6, 2018| Page 6| 7", false, t)
+}
+
+const datesBibliography = `
+\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, June 2018a
+\bibitem{se} Ross Anderson, Security Engineering, 2018b
+\bibitem{psc} Ross Anderson, Programming Satan's Computer, 2017--2018
+\bibitem{tamper} Ross Anderson, Tamper Resistance, in press
+\end{thebibliography}
+`
+
+const expectedDatesBib = `@online{anderson2018a,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "2018",
+	month = jun,
+}
+
+@online{anderson2018b,
+	author = "Ross Anderson",
+	title = {{Security Engineering}},
+	year = "2018",
+}
+
+@online{anderson2017,
+	author = "Ross Anderson",
+	title = {{Programming Satan's Computer}},
+	year = {2017--2018},
+}
+
+@online{anderson,
+	author = "Ross Anderson",
+	title = {{Tamper Resistance}},
+	pubstate = {inpress},
+}
+
+`
+
+const expectedDatesBibLaTeX = `@online{anderson2018a,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	date = {2018-06},
+}
+
+@online{anderson2018b,
+	author = "Ross Anderson",
+	title = {{Security Engineering}},
+	year = "2018",
+}
+
+@online{anderson2017,
+	author = "Ross Anderson",
+	title = {{Programming Satan's Computer}},
+	date = {2017/2018},
+}
+
+@online{anderson,
+	author = "Ross Anderson",
+	title = {{Tamper Resistance}},
+	pubstate = {inpress},
+}
+
+`
+
+func TestCompleteDates(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output:     &writer,
+		Input:      strings.NewReader(datesBibliography),
+		KeyPattern: "{author}{year}",
+	}
+	runTestComplete(config, expectedDatesBib, t)
+}
+
+func TestCompleteDatesBibLaTeX(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output:     &writer,
+		Input:      strings.NewReader(datesBibliography),
+		KeyPattern: "{author}{year}",
+		Dialect:    DialectBibLaTeX,
+	}
+	runTestComplete(config, expectedDatesBibLaTeX, t)
+}
+
+func TestDatesGenKey(t *testing.T) {
+	list := `\begin{references}
+Ross Anderson, Why Cryptosystems Fail, June 2018
+
+Ross Anderson, Programming Satan's Computer, 2017--2018
+\end{references}
+`
+	for _, dialect := range []Dialect{DialectBibTeX, DialectBibLaTeX} {
+		entries, err := ReadEntries(&Config{Input: strings.NewReader(list), Dialect: dialect})
+		if err != nil {
+			t.Fatalf("Fail to read: %s", err)
+		}
+		gotExpected(entries[0].Key, "Why Cryptosystems Fail-2018-Ross Anderson", false, t)
+		gotExpected(entries[1].Key, "Programming Satan's Computer-2017-Ross Anderson", false, t)
+	}
+}
+
+func TestDatesDuplicate(t *testing.T) {
+	a := &Entry{Title: "Why Cryptosystems Fail", Fields: map[string]string{"date": "2018-06"}}
+	b := &Entry{Title: "Why Cryptosystems Fail", Year: 2017}
+	if duplicate, _ := IsDuplicate(a, b); duplicate {
+		t.Error("Entries of different years are duplicates")
+	}
+	b.Year = 2018
+	if duplicate, _ := IsDuplicate(a, b); !duplicate {
+		t.Error("Entries of the same year aren't duplicates")
+	}
+}
+
+func TestDatesOneYear(t *testing.T) {
+	ranged := func() *Entry {
+		return &Entry{Title: "Why", Fields: map[string]string{"year": "2017--2018"}}
+	}
+	dated := func() *Entry {
+		return &Entry{Title: "Why", Year: 2019}
+	}
+	tests := []struct {
+		name     string
+		entry    *Entry
+		apply    func(*Entry)
+		expected string
+	}{
+		{"a resolved year replaces a range", ranged(), func(b *Entry) { b.Enrich(dated()) }, "2019"},
+		{"a resolved range replaces a year", dated(), func(b *Entry) { b.Enrich(ranged()) }, "2017--2018"},
+		{"a range is kept without a resolved year", ranged(), func(b *Entry) { b.Enrich(&Entry{Title: "Why"}) }, "2017--2018"},
+		{"the first range is kept", ranged(), func(b *Entry) { b.Merge(dated(), ConflictFirst) }, "2017--2018"},
+		{"the first year is kept", dated(), func(b *Entry) { b.Merge(ranged(), ConflictFirst) }, "2019"},
+		{"the last year replaces a range", ranged(), func(b *Entry) { b.Merge(dated(), ConflictLast) }, "2019"},
+		{"the last range replaces a year", dated(), func(b *Entry) { b.Merge(ranged(), ConflictLast) }, "2017--2018"},
+		{"the longest is the range", dated(), func(b *Entry) { b.Merge(ranged(), ConflictLongest) }, "2017--2018"},
+		{"a missing year is taken", &Entry{Title: "Why"}, func(b *Entry) { b.Merge(ranged(), ConflictFirst) }, "2017--2018"},
+	}
+
+	for _, test := range tests {
+		test.apply(test.entry)
+		year, _ := test.entry.fieldValue("year")
+		if year != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.name, year, test.expected)
+		}
+		if n := strings.Count(test.entry.String(), "year = "); n != 1 {
+			t.Errorf("%s: %d year fields:\n%s", test.name, n, test.entry)
+		}
+	}
+}
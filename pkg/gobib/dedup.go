@@ -0,0 +1,324 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DedupMode tells what to do with the duplicate entries.
+type DedupMode int
+
+const (
+	// DedupOff doesn't look for duplicates.
+	DedupOff DedupMode = iota
+	// DedupReport warns about the duplicates, keeping them.
+	DedupReport
+	// DedupKeepFirst keeps only the first of the duplicates.
+	DedupKeepFirst
+	// DedupMerge merges the duplicates into the first one.
+	DedupMerge
+)
+
+// DedupModes are the modes by name, as they're given on
+// the command line.
+var DedupModes = map[string]DedupMode{
+	"off":        DedupOff,
+	"report":     DedupReport,
+	"keep-first": DedupKeepFirst,
+	"merge":      DedupMerge,
+}
+
+// ConflictPolicy tells which value is kept when merging two
+// entries having a different value for the same field.
+type ConflictPolicy int
+
+const (
+	// ConflictFirst keeps the value of the first entry.
+	ConflictFirst ConflictPolicy = iota
+	// ConflictLast keeps the value of the last entry.
+	ConflictLast
+	// ConflictLongest keeps the longest value.
+	ConflictLongest
+)
+
+// ConflictPolicies are the policies by name.
+var ConflictPolicies = map[string]ConflictPolicy{
+	"first":   ConflictFirst,
+	"last":    ConflictLast,
+	"longest": ConflictLongest,
+}
+
+// titleSimilarity is how much two titles must be alike
+// for their entries to be duplicates.
+const titleSimilarity = 0.9
+
+// Duplicate is an entry found to be a duplicate of another one.
+type Duplicate struct {
+	// Key is the key of the duplicate
+	Key string
+	// Of is the key of the entry it duplicates, which comes first
+	Of string
+	// Reason tells why they're duplicates
+	Reason string
+}
+
+// NormalizeTitle returns a title in lower case, without
+// TeX commands, braces and punctuation, so that it can
+// be compared to another one.
+func NormalizeTitle(title string) string {
+	var normalized strings.Builder
+	for i := 0; i < len(title); {
+		r, size := utf8.DecodeRuneInString(title[i:])
+		if r == '\\' {
+			// skipping the command name, or the escaped char
+			i += size
+			if i < len(title) && isLetter(title[i]) {
+				for i < len(title) && isLetter(title[i]) {
+					i++
+				}
+			} else if i < len(title) {
+				_, size = utf8.DecodeRuneInString(title[i:])
+				i += size
+			}
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			normalized.WriteRune(unicode.ToLower(r))
+		} else if r != '{' && r != '}' {
+			normalized.WriteByte(' ')
+		}
+		i += size
+	}
+	return strings.Join(strings.Fields(normalized.String()), " ")
+}
+
+// similarity returns how much two strings are alike, from 0 to 1,
+// based on their Levenshtein distance.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
+
+// isLetter tells if c is an ASCII letter.
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// DOI returns the DOI of the entry in lower case, without
+// the 'https://doi.org/' prefix, or an empty string.
+func (b *Entry) DOI() string {
+	doi := strings.ToLower(strings.TrimSpace(b.Fields["doi"]))
+	if index := strings.Index(doi, "10."); index != -1 {
+		doi = doi[index:]
+	}
+	return doi
+}
+
+// firstSurname returns the surname of the first author, as a key part.
+func (b *Entry) firstSurname() string {
+	if len(b.Authors) == 0 {
+		return ""
+	}
+	return keyPart(Surname(b.Authors[0]))
+}
+
+// IsDuplicate tells if two entries are likely the same work, and why.
+// They are when they have the same DOI, or when they have similar
+// titles, the same year and the same first author surname; a missing
+// year or author doesn't prevent two entries from being duplicates.
+func IsDuplicate(a, b *Entry) (bool, string) {
+	if doiA, doiB := a.DOI(), b.DOI(); doiA != "" && doiB != "" {
+		return doiA == doiB, "same DOI"
+	}
+
+	if yearA, yearB := a.FirstYear(), b.FirstYear(); yearA != emptyYear && yearB != emptyYear && yearA != yearB {
+		return false, ""
+	}
+	if surnameA, surnameB := a.firstSurname(), b.firstSurname(); surnameA != "" && surnameB != "" && surnameA != surnameB {
+		return false, ""
+	}
+
+	titleA, titleB := NormalizeTitle(a.Title), NormalizeTitle(b.Title)
+	if titleA == "" || titleB == "" {
+		return false, ""
+	}
+	// the similarity can't be greater than the ratio of the lengths
+	shortest, longest := len(titleA), len(titleB)
+	if shortest > longest {
+		shortest, longest = longest, shortest
+	}
+	if float64(shortest)/float64(longest) < titleSimilarity {
+		return false, ""
+	}
+	return similarity(titleA, titleB) >= titleSimilarity, "similar title"
+}
+
+// Dedup looks for the duplicate entries, comparing each one to those
+// coming before it. Depending on mode, the duplicates are kept, dropped
+// or merged into the first entry, using policy for the conflicts.
+// It returns the resulting entries and the duplicates found.
+func Dedup(entries []*Entry, mode DedupMode, policy ConflictPolicy) ([]*Entry, []Duplicate) {
+	var result []*Entry
+	var duplicates []Duplicate
+
+	for _, entry := range entries {
+		duplicate := false
+		for _, kept := range result {
+			if ok, reason := IsDuplicate(kept, entry); ok {
+				duplicates = append(duplicates, Duplicate{Key: entry.Key, Of: kept.Key, Reason: reason})
+				switch mode {
+				case DedupKeepFirst:
+					duplicate = true
+				case DedupMerge:
+					kept.Merge(entry, policy)
+					duplicate = true
+				}
+				break
+			}
+		}
+		if !duplicate {
+			result = append(result, entry)
+		}
+	}
+	return result, duplicates
+}
+
+// Merge merges src into the entry: the fields the entry doesn't
+// have are taken from src, and when both have a field with a
+// different value policy decides which one is kept. The fields
+// taken from src are recorded in the entry Provenance.
+func (b *Entry) Merge(src *Entry, policy ConflictPolicy) {
+	pick := func(value, other string) string {
+		switch {
+		case other == "":
+			return value
+		case value == "", policy == ConflictLast:
+			return other
+		case policy == ConflictLongest && len(other) > len(value):
+			return other
+		}
+		return value
+	}
+
+	b.Type = pick(b.Type, src.Type)
+	if title := pick(b.Title, src.Title); title != b.Title {
+		b.Title = title
+		b.takeFrom("title", src)
+	}
+	if url := pick(b.URL, src.URL); url != b.URL {
+		b.URL = url
+		b.takeFrom("url", src)
+	}
+
+	if len(src.Authors) > 0 && (len(b.Authors) == 0 || policy == ConflictLast ||
+		(policy == ConflictLongest && len(src.Authors) > len(b.Authors))) {
+		b.Authors = src.Authors
+		b.takeFrom("author", src)
+	}
+	// the year is either Year or a range in the fields
+	year, _ := b.fieldValue("year")
+	srcYear, _ := src.fieldValue("year")
+	if pick(year, srcYear) != year {
+		b.copyYear(src)
+		b.takeFrom("year", src)
+	}
+	if src.Visited != nil && (b.Visited == nil || policy == ConflictLast) {
+		b.Visited = src.Visited
+		b.takeFrom("urldate", src)
+	}
+
+	for name, value := range src.Fields {
+		if name == "year" {
+			continue
+		}
+		if b.Fields == nil {
+			b.Fields = make(map[string]string)
+		}
+		if field := pick(b.Fields[name], value); field != b.Fields[name] {
+			b.Fields[name] = field
+			b.takeFrom(name, src)
+		}
+	}
+}
+
+// dedup is the pass looking for duplicates among the converted
+// entries. The keys of the dropped entries become aliases of the
+// kept ones in the key map, so that the \cite can be redirected.
+func (c *Tex2BibConverter) dedup(entries []*Entry) []*Entry {
+	result, duplicates := Dedup(entries, c.config.Dedup, c.config.Conflict)
+	for _, duplicate := range duplicates {
+		switch c.config.Dedup {
+		case DedupReport:
+			c.warnf("%s looks like a duplicate of %s (%s)", duplicate.Key, duplicate.Of, duplicate.Reason)
+		case DedupKeepFirst:
+			c.warnf("%s dropped, it's a duplicate of %s (%s)", duplicate.Key, duplicate.Of, duplicate.Reason)
+			c.alias(duplicate.Key, duplicate.Of)
+		case DedupMerge:
+			c.warnf("%s merged into %s (%s)", duplicate.Key, duplicate.Of, duplicate.Reason)
+			c.alias(duplicate.Key, duplicate.Of)
+		}
+	}
+	return result
+}
+
+// alias records in the key map that the key from is now to.
+func (c *Tex2BibConverter) alias(from, to string) {
+	for old, key := range c.keyMap {
+		if key == from {
+			c.keyMap[old] = to
+		}
+	}
+	if from != to {
+		c.keyMap[from] = to
+	}
+}
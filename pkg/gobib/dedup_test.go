@@ -0,0 +1,148 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+const duplicatesBibliography = `
+\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, 1994, \doi{10.1145/175222.175223}
+\bibitem{anderson94} R. Anderson, Why cryptosystems fail!, \url{example.com/wcf.pdf}
+\bibitem{other} Ross Anderson, Why Cryptosystems Don't Fail, 1994
+\bibitem{doi} Someone Else, Whatever, 2000, \doi{10.1145/175222.175223}
+\end{thebibliography}
+`
+
+const expectedMergedBib = `@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1994",
+	url = {example.com/wcf.pdf},
+	doi = {10.1145/175222.175223},
+}
+
+@online{other,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Don't Fail}},
+	year = "1994",
+}
+
+`
+
+const expectedMergedWarnings = `warning: anderson94 merged into wcf (similar title)
+warning: doi merged into wcf (same DOI)
+`
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := map[string]string{
+		"Why {C}ryptosystems Fail!":    "why cryptosystems fail",
+		"\\emph{M{\\\"u}ller's} Law":   "muller s law",
+		"  The   TeX--book  ":          "the tex book",
+		"\\LaTeX{}: A Document System": "a document system",
+	}
+	for title, expected := range tests {
+		gotExpected(NormalizeTitle(title), expected, false, t)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if s := similarity("kitten", "sitting"); s < 0.57 || s > 0.58 {
+		t.Errorf("Wrong similarity: %f", s)
+	}
+	if s := similarity("same", "same"); s != 1 {
+		t.Errorf("Wrong similarity: %f", s)
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	a := NewEntry("a", []string{"Ross Anderson"}, "Why Cryptosystems Fail", 1994, "", nil)
+	b := NewEntry("b", []string{"R. Anderson"}, "Why cryptosystems fail", 0, "", nil)
+	c := NewEntry("c", []string{"Ross Anderson"}, "Why Cryptosystems Fail", 1995, "", nil)
+	d := NewEntry("d", []string{"Someone Else"}, "Why Cryptosystems Fail", 1994, "", nil)
+
+	if ok, _ := IsDuplicate(a, b); !ok {
+		t.Error("a and b are duplicates")
+	}
+	if ok, _ := IsDuplicate(a, c); ok {
+		t.Error("a and c are not duplicates, the year is different")
+	}
+	if ok, _ := IsDuplicate(a, d); ok {
+		t.Error("a and d are not duplicates, the author is different")
+	}
+
+	a.Fields = map[string]string{"doi": "https://doi.org/10.1/X"}
+	d.Fields = map[string]string{"doi": "10.1/x"}
+	if ok, reason := IsDuplicate(a, d); !ok || reason != "same DOI" {
+		t.Error("a and d are duplicates, the DOI is the same")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	first := NewEntry("a", []string{"R. Anderson"}, "Why", 1994, "", nil)
+	last := NewEntry("b", []string{"Ross Anderson", "Other"}, "Why Cryptosystems Fail", 0, "example.com", nil)
+
+	merged := *first
+	merged.Merge(last, ConflictFirst)
+	gotExpected(merged.Title, "Why", false, t)
+	gotExpected(merged.URL, "example.com", false, t)
+
+	merged = *first
+	merged.Merge(last, ConflictLongest)
+	gotExpected(merged.Title, "Why Cryptosystems Fail", false, t)
+	gotExpected(merged.AuthorsToString(), "Ross Anderson and Other", false, t)
+
+	merged = *first
+	merged.Merge(last, ConflictLast)
+	if merged.Year != 1994 {
+		t.Errorf("The year is lost: %d", merged.Year)
+	}
+}
+
+func TestCompleteDedupMerge(t *testing.T) {
+	var writer, warnings strings.Builder
+	config := &Config{
+		Output:   &writer,
+		Input:    strings.NewReader(duplicatesBibliography),
+		Dedup:    DedupMerge,
+		Warnings: &warnings,
+	}
+	runTestComplete(config, expectedMergedBib, t)
+	gotExpected(warnings.String(), expectedMergedWarnings, false, t)
+}
+
+func TestDedupKeyMap(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(duplicatesBibliography),
+		Dedup:  DedupKeepFirst,
+	}
+	converter := initConverter(config)
+	converter.Converter.Convert()
+	<-converter.Converter.OkChan()
+
+	keys := converter.Converter.KeyMap()
+	gotExpected(keys["anderson94"], "wcf", false, t)
+	gotExpected(keys["doi"], "wcf", false, t)
+	if len(keys) != 2 {
+		t.Errorf("Mismatch length: %v", keys)
+	}
+}
@@ -0,0 +1,166 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+// ChangeKind is the kind of change of an entry between
+// two bibliographies.
+type ChangeKind int
+
+const (
+	// EntryAdded is an entry only in the new bibliography.
+	EntryAdded ChangeKind = iota
+	// EntryRemoved is an entry only in the old bibliography.
+	EntryRemoved
+	// EntryChanged is an entry having the same key in both,
+	// with different fields.
+	EntryChanged
+	// EntryRenamed is an entry having a different key in the
+	// new bibliography, and maybe different fields.
+	EntryRenamed
+)
+
+// String returns the name of the kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case EntryAdded:
+		return "added"
+	case EntryRemoved:
+		return "removed"
+	case EntryChanged:
+		return "changed"
+	}
+	return "renamed"
+}
+
+// FieldChange is a field having different values in
+// two versions of an entry. A missing field is empty.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// EntryChange is an entry that differs between two bibliographies.
+type EntryChange struct {
+	Kind ChangeKind
+	// Old and New are the entry in the two bibliographies,
+	// Old is nil if it's added, New if it's removed
+	Old *Entry
+	New *Entry
+	// Fields are the fields that differ
+	Fields []FieldChange
+	// Reason tells how a renamed entry was matched
+	Reason string
+}
+
+// DiffEntries compares two bibliographies and returns the entries
+// that differ: those added, removed, changed and renamed. The entries
+// are matched by key, or else when they have the same DOI or similar
+// titles, see IsDuplicate. The changes follow the order of the new
+// entries, the removed ones come last.
+func DiffEntries(oldEntries, newEntries []*Entry) []EntryChange {
+	byKey := make(map[string]*Entry)
+	for _, entry := range oldEntries {
+		if _, ok := byKey[entry.Key]; !ok {
+			byKey[entry.Key] = entry
+		}
+	}
+
+	matched := make(map[*Entry]*Entry)
+	var unmatched []*Entry
+	for _, entry := range newEntries {
+		if old, ok := byKey[entry.Key]; ok && matched[old] == nil {
+			matched[old] = entry
+		} else {
+			unmatched = append(unmatched, entry)
+		}
+	}
+
+	renamed := make(map[*Entry]*Entry)
+	reasons := make(map[*Entry]string)
+	for _, entry := range unmatched {
+		for _, old := range oldEntries {
+			if matched[old] != nil {
+				continue
+			}
+			if ok, reason := IsDuplicate(old, entry); ok {
+				matched[old] = entry
+				renamed[entry] = old
+				reasons[entry] = reason
+				break
+			}
+		}
+	}
+
+	var changes []EntryChange
+	for _, entry := range newEntries {
+		old, isRenamed := renamed[entry]
+		if !isRenamed {
+			var ok bool
+			if old, ok = byKey[entry.Key]; !ok || matched[old] != entry {
+				changes = append(changes, EntryChange{Kind: EntryAdded, New: entry})
+				continue
+			}
+		}
+
+		fields := diffFields(old, entry)
+		switch {
+		case isRenamed:
+			changes = append(changes, EntryChange{Kind: EntryRenamed, Old: old, New: entry, Fields: fields, Reason: reasons[entry]})
+		case len(fields) > 0:
+			changes = append(changes, EntryChange{Kind: EntryChanged, Old: old, New: entry, Fields: fields})
+		}
+	}
+
+	for _, old := range oldEntries {
+		if matched[old] == nil {
+			changes = append(changes, EntryChange{Kind: EntryRemoved, Old: old})
+		}
+	}
+	return changes
+}
+
+// diffFields returns the fields of two entries that differ,
+// in the order they're written.
+func diffFields(old, new *Entry) []FieldChange {
+	var changes []FieldChange
+	if oldType, newType := old.entryType(), new.entryType(); oldType != newType {
+		changes = append(changes, FieldChange{Field: "type", Old: oldType, New: newType})
+	}
+
+	var written Format
+	seen := make(map[string]bool)
+	for _, entry := range []*Entry{old, new} {
+		for _, field := range entry.FieldNames() {
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			oldValue, _ := old.fieldValue(field)
+			newValue, _ := new.fieldValue(field)
+			if field == "title" && written.title(oldValue) == written.title(newValue) {
+				// the same title once written
+				continue
+			}
+			if oldValue != newValue {
+				changes = append(changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+			}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,90 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const oldDiffBib = `@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1909",
+}
+
+@online{wcdf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Don't Fail}},
+}
+
+@online{aass,
+	author = "Asking Alexandria",
+	title = {{Someone Somewhere}},
+	year = "2011",
+}
+
+@article{gone,
+	author = "Nobody",
+	title = {{Removed}},
+	doi = {10.1000/gone},
+}
+`
+
+const newDiffTex = `\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, 1994
+\bibitem{anderson-wcdf} Ross Anderson, Why Cryptosystems Dont Fail
+\bibitem{aass} Asking Alexandria, Someone Somewhere, 2011
+\bibitem{new} Someone New, Added, 2020
+\end{thebibliography}
+`
+
+func TestDiffEntries(t *testing.T) {
+	oldEntries, err := ParseBibTeX(strings.NewReader(oldDiffBib), "old.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newEntries, err := ReadEntries(&Config{Input: strings.NewReader(newDiffTex), Name: "new.tex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, change := range DiffEntries(oldEntries, newEntries) {
+		description := change.Kind.String()
+		if change.Old != nil {
+			description += " " + change.Old.Key
+		}
+		if change.New != nil {
+			description += " " + change.New.Key
+		}
+		for _, field := range change.Fields {
+			description += fmt.Sprintf(" %s:%q->%q", field.Field, field.Old, field.New)
+		}
+		got = append(got, description)
+	}
+
+	expected := []string{
+		`changed wcf wcf year:"1909"->"1994"`,
+		`renamed wcdf anderson-wcdf title:"{Why Cryptosystems Don't Fail}"->"Why Cryptosystems Dont Fail"`,
+		`added new`,
+		`removed gone`,
+	}
+	gotExpected(strings.Join(got, "\n"), strings.Join(expected, "\n"), false, t)
+}
@@ -0,0 +1,55 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// doiRegexp matches a DOI written with '\doi{...}' or as
+// 'doi: ...', with the comma that may precede it.
+var doiRegexp = regexp.MustCompile(`,?\s*(?:\\doi\{([^}]*)\}|(?i:doi):?\s*(10\.[0-9]{4,9}/[^\s{}]+))`)
+
+// doiURLRegexp matches a DOI inside an URL, like 'https://doi.org/10.1145/1234'.
+var doiURLRegexp = regexp.MustCompile(`doi\.org/(10\.[0-9]{4,9}/[^\s{}]+)`)
+
+// cutDOI removes the DOI, if any, from a plain TeX bib entry,
+// so that it's not mistaken for the title or an author. It
+// returns the entry without the DOI and the DOI.
+// A DOI that is part of an URL is returned but not removed.
+func cutDOI(value string) (string, string) {
+	if match := doiRegexp.FindStringSubmatchIndex(value); match != nil {
+		var doi string
+		if match[2] != -1 {
+			doi = value[match[2]:match[3]]
+		} else {
+			doi = value[match[4]:match[5]]
+		}
+		return value[:match[0]] + value[match[1]:], cleanDOI(doi)
+	}
+	if match := doiURLRegexp.FindStringSubmatch(value); match != nil {
+		return value, cleanDOI(match[1])
+	}
+	return value, ""
+}
+
+// cleanDOI removes the punctuation that may follow a DOI.
+func cleanDOI(doi string) string {
+	return strings.TrimRight(strings.TrimSpace(doi), ".,;")
+}
@@ -0,0 +1,38 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"testing"
+)
+
+func TestCutDOI(t *testing.T) {
+	tests := []struct {
+		value, rest, doi string
+	}{
+		{"A, Title, 2019, \\doi{10.1145/1234.5678}", "A, Title, 2019", "10.1145/1234.5678"},
+		{"A. Title. DOI: 10.1000/xyz123.", "A. Title.", "10.1000/xyz123"},
+		{"A, Title, \\url{https://doi.org/10.1000/abc}", "A, Title, \\url{https://doi.org/10.1000/abc}", "10.1000/abc"},
+		{"A, Title, 2019", "A, Title, 2019", ""},
+	}
+	for _, test := range tests {
+		rest, doi := cutDOI(test.value)
+		gotExpected(rest, test.rest, false, t)
+		gotExpected(doi, test.doi, false, t)
+	}
+}
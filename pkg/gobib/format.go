@@ -0,0 +1,382 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TitleProtection tells which parts of the title are protected
+// by braces from the case changes made by the bibliography styles.
+type TitleProtection int
+
+const (
+	// ProtectWhole protects the whole title, which is
+	// printed exactly as it's written.
+	ProtectWhole TitleProtection = iota
+	// ProtectSmart protects only the words whose case matters:
+	// acronyms, words with internal capitals, chemical formulas
+	// and, in sentence-cased titles, proper nouns. The styles
+	// can change the case of the rest.
+	ProtectSmart
+	// ProtectKeep writes the title as it is, e.g. as it was
+	// read from a BibTeX file.
+	ProtectKeep
+)
+
+// TitleProtections are the protections by name. ProtectKeep,
+// used for BibTeX input, has none.
+var TitleProtections = map[string]TitleProtection{
+	"whole": ProtectWhole,
+	"smart": ProtectSmart,
+}
+
+// TitleCase is the case the ALL-CAPS titles are converted to.
+type TitleCase int
+
+const (
+	// CaseKeep leaves the titles as they are.
+	CaseKeep TitleCase = iota
+	// CaseTitle converts them to 'Title Case'.
+	CaseTitle
+	// CaseSentence converts them to 'Sentence case'.
+	CaseSentence
+)
+
+// TitleCases are the cases by name.
+var TitleCases = map[string]TitleCase{
+	"keep":     CaseKeep,
+	"title":    CaseTitle,
+	"sentence": CaseSentence,
+}
+
+// Format tells how the entries are written. The zero
+// Format is the one used by Entry.String.
+type Format struct {
+	// Protection tells how the title is protected
+	Protection TitleProtection
+	// Case is the case the ALL-CAPS titles are converted to
+	Case TitleCase
+	// Indent is the indentation of the fields, a tab if empty
+	Indent string
+	// Align aligns the '=' of the fields
+	Align bool
+	// Braces writes all the values in braces, instead of quoting
+	// the author and the year, and the urldate in ISO format
+	Braces bool
+	// FieldOrder are the fields written first, in this order,
+	// the others follow sorted by name. If nil, they're author,
+	// title, year, url and urldate.
+	FieldOrder []string
+	// MonthMacros writes the months as the BibTeX macros jan,
+	// feb, ..., also when they're written as names or numbers
+	MonthMacros bool
+	// NoTrailingComma omits the comma after the last field
+	NoTrailingComma bool
+	// OmitEmpty omits the author and the title when they're
+	// empty, otherwise they're always written
+	OmitEmpty bool
+	// KeepMacros writes the values in Entry.Raw as they are,
+	// with their macros, instead of expanded
+	KeepMacros bool
+}
+
+// CanonicalFieldOrder is the field order used by gobib fmt.
+var CanonicalFieldOrder = []string{
+	"author", "editor", "title", "subtitle", "booktitle", "journal", "journaltitle",
+	"series", "volume", "number", "edition", "chapter", "pages",
+	"publisher", "organization", "institution", "school", "address", "location",
+	"howpublished", "type", "year", "month", "date", "note",
+	"isbn", "issn", "doi", "url", "urldate", "eprint", "eprinttype", "pubstate",
+}
+
+// months are the BibTeX month macros, by the month names,
+// their abbreviations and numbers.
+var months = map[string]string{}
+
+// monthMacros are the BibTeX month macros, in order, and
+// monthNumbers their numbers, starting from 1.
+var monthMacros []string
+var monthNumbers = map[string]int{}
+
+func init() {
+	for i, month := range []string{
+		"january", "february", "march", "april", "may", "june", "july",
+		"august", "september", "october", "november", "december",
+	} {
+		macro := month[:3]
+		months[month] = macro
+		months[macro] = macro
+		months[strconv.Itoa(i+1)] = macro
+		months[fmt.Sprintf("%02d", i+1)] = macro
+		monthMacros = append(monthMacros, macro)
+		monthNumbers[macro] = i + 1
+	}
+	months["sept"] = "sep"
+}
+
+// formattedField is a field as it's written.
+type formattedField struct {
+	name  string
+	value string
+}
+
+// quote returns a value quoted, or in braces.
+func (f Format) quote(value string) string {
+	if f.Braces {
+		return "{" + value + "}"
+	}
+	return "\"" + value + "\""
+}
+
+// month returns the value of the month field as it's written.
+// The macros, which can't be told apart from the same text in
+// braces once read, are written as macros.
+func (f Format) month(month string) string {
+	macro, ok := months[strings.ToLower(strings.Trim(month, "{}. "))]
+	if ok && (f.MonthMacros || month == macro) {
+		return macro
+	}
+	return "{" + month + "}"
+}
+
+// fields returns the fields of an entry as they're written, in order.
+func (f Format) fields(b *Entry) []formattedField {
+	var fields []formattedField
+	if len(b.Authors) > 0 || !f.OmitEmpty {
+		fields = append(fields, formattedField{"author", f.quote(b.AuthorsToString())})
+	}
+	if b.Title != emptyString || !f.OmitEmpty {
+		fields = append(fields, formattedField{"title", "{" + f.title(b.Title) + "}"})
+	}
+	if b.Year != emptyYear {
+		fields = append(fields, formattedField{"year", f.quote(strconv.Itoa(b.Year))})
+	}
+	if b.URL != emptyString {
+		fields = append(fields, formattedField{"url", "{" + b.URL + "}"})
+	}
+	if b.Visited != nil {
+		year, month, day := b.Visited.Date()
+		if f.Braces {
+			fields = append(fields, formattedField{"urldate", "{" + b.Visited.Format("2006-01-02") + "}"})
+		} else {
+			fields = append(fields, formattedField{"urldate", fmt.Sprintf("\"%d-%d-%d\"", year, month, day)})
+		}
+	}
+
+	names := make([]string, 0, len(b.Fields))
+	for name := range b.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := "{" + b.Fields[name] + "}"
+		if name == "month" {
+			value = f.month(b.Fields[name])
+		}
+		fields = append(fields, formattedField{name, value})
+	}
+	if f.KeepMacros {
+		for i, field := range fields {
+			if raw, ok := b.Raw[field.name]; ok {
+				fields[i].value = raw
+			}
+		}
+	}
+
+	if f.FieldOrder != nil {
+		rank := make(map[string]int)
+		for i, name := range f.FieldOrder {
+			rank[name] = i + 1
+		}
+		sort.SliceStable(fields, func(i, j int) bool {
+			rankI, rankJ := rank[fields[i].name], rank[fields[j].name]
+			switch {
+			case rankI == 0 && rankJ == 0:
+				return fields[i].name < fields[j].name
+			case rankI == 0 || rankJ == 0:
+				return rankJ == 0
+			}
+			return rankI < rankJ
+		})
+	}
+	return fields
+}
+
+// title returns the title as it's written, without the
+// braces of the field value.
+func (f Format) title(title string) string {
+	if f.Case != CaseKeep && isAllCaps(title) {
+		title = changeCase(title, f.Case)
+	}
+	switch {
+	case f.Protection == ProtectSmart:
+		return protectWords(title)
+	case f.Protection == ProtectKeep, isProtected(title):
+		return title
+	}
+	return "{" + title + "}"
+}
+
+// mapWords returns s with the words outside braces replaced by f.
+// Brace groups and TeX commands are kept as they are. first is
+// true for the words starting a sentence, like the first one or
+// those following a colon.
+func mapWords(s string, f func(word string, first bool) string) string {
+	var result strings.Builder
+	first := true
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '{':
+			_, end, ok := braceGroup(s, i)
+			if !ok {
+				end = len(s)
+			}
+			result.WriteString(s[i:end])
+			i = end
+			first = false
+		case c == '\\':
+			end := i + 1
+			for end < len(s) && isLetter(s[end]) {
+				end++
+			}
+			if end == i+1 && end < len(s) {
+				end++
+			}
+			result.WriteString(s[i:end])
+			i = end
+		case c == ' ' || c == '\t' || c == '\n':
+			result.WriteByte(c)
+			i++
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t\n{\\", rune(s[end])) {
+				end++
+			}
+			word := s[i:end]
+			result.WriteString(f(word, first))
+			i = end
+			first = strings.ContainsAny(word[len(word)-1:], ":.?!")
+		}
+	}
+	return result.String()
+}
+
+// changeCase returns an ALL-CAPS title in title or sentence case.
+// The acronyms can't be told apart from the other words, they
+// should be protected by braces in the original title.
+func changeCase(title string, mode TitleCase) string {
+	return mapWords(title, func(word string, first bool) string {
+		lower := strings.ToLower(word)
+		if mode == CaseSentence && !first {
+			return lower
+		}
+		if mode == CaseTitle && !first && keyStopWords[strings.Trim(lower, ",;:.?!")] {
+			return lower
+		}
+		parts := strings.Split(lower, "-")
+		for i, part := range parts {
+			if mode == CaseTitle || i == 0 {
+				parts[i] = capitalize(part)
+			}
+		}
+		return strings.Join(parts, "-")
+	})
+}
+
+// capitalize returns s with its first letter in upper case.
+func capitalize(s string) string {
+	for i, r := range s {
+		if unicode.IsLetter(r) {
+			return s[:i] + string(unicode.ToUpper(r)) + s[i+utf8.RuneLen(r):]
+		}
+	}
+	return s
+}
+
+// isSentenceCase tells if most of the words of a title that
+// may be capitalised, the first one excluded, are not.
+func isSentenceCase(title string) bool {
+	upper, lower := 0, 0
+	mapWords(title, func(word string, first bool) string {
+		r, _ := utf8.DecodeRuneInString(word)
+		switch {
+		case first || keyStopWords[strings.ToLower(word)]:
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+		return word
+	})
+	return lower > upper
+}
+
+// protectWords protects by braces the words of a title whose case
+// must be kept: see ProtectSmart.
+func protectWords(title string) string {
+	properNouns := isSentenceCase(title)
+	return mapWords(title, func(word string, first bool) string {
+		// the punctuation around the word is left outside
+		start := strings.IndexFunc(word, isWordRune)
+		if start == -1 {
+			return word
+		}
+		last := strings.LastIndexFunc(word, isWordRune)
+		_, size := utf8.DecodeRuneInString(word[last:])
+		end := last + size
+
+		parts := strings.Split(word[start:end], "-")
+		for i, part := range parts {
+			if needsProtection(part, properNouns && !(first && i == 0)) {
+				parts[i] = "{" + part + "}"
+			}
+		}
+		return word[:start] + strings.Join(parts, "-") + word[end:]
+	})
+}
+
+// isWordRune tells if r can be part of a word to protect.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// needsProtection tells if a word must be protected: when it has an
+// upper case letter after the first one (YABE, TeX), when it has
+// both upper case letters and digits (H2O), or when it's capitalised
+// and properNoun is true.
+func needsProtection(word string, properNoun bool) bool {
+	digits, upper := false, false
+	for i, r := range word {
+		switch {
+		case unicode.IsDigit(r):
+			digits = true
+		case unicode.IsUpper(r):
+			if i > 0 {
+				return true
+			}
+			upper = true
+		}
+	}
+	return upper && (digits || properNoun)
+}
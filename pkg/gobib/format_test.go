@@ -0,0 +1,119 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProtectWords(t *testing.T) {
+	tests := map[string]string{
+		"YABE -- Yet Another Bib Entry":                "{YABE} -- Yet Another Bib Entry",
+		"Typesetting with TeX and {LaTeX}":             "Typesetting with {TeX} and {LaTeX}",
+		"The H2O molecule, (NSA) and iPhone-based USB": "The {H2O} molecule, ({NSA}) and {iPhone}-based {USB}",
+		"Why cryptosystems fail in Europe":             "Why cryptosystems fail in {Europe}",
+		"Attacks: New results on Schnorr signatures":   "Attacks: New results on {Schnorr} signatures",
+		"Why Cryptosystems Fail":                       "Why Cryptosystems Fail",
+		"Fast \\emph{Fourier} transforms":              "Fast \\emph{Fourier} transforms",
+	}
+	for title, expected := range tests {
+		gotExpected(protectWords(title), expected, false, t)
+	}
+}
+
+func TestChangeCase(t *testing.T) {
+	title := "WHY CRYPTOSYSTEMS FAIL: A STUDY OF {ATM} FRAUD-DETECTION"
+	gotExpected(changeCase(title, CaseTitle), "Why Cryptosystems Fail: A Study of {ATM} Fraud-Detection", false, t)
+	gotExpected(changeCase(title, CaseSentence), "Why cryptosystems fail: A study of {ATM} fraud-detection", false, t)
+}
+
+func TestFormatTitle(t *testing.T) {
+	entry := &Entry{Key: "key", Title: "WHY CRYPTOSYSTEMS FAIL IN {ATM} NETWORKS"}
+
+	expected := "@online{key,\n\tauthor = \"\",\n\ttitle = {{WHY CRYPTOSYSTEMS FAIL IN {ATM} NETWORKS}},\n}"
+	gotExpected(entry.String(), expected, false, t)
+	gotExpected(entry.Formatted(Format{}), expected, false, t)
+
+	expected = "@online{key,\n\tauthor = \"\",\n\ttitle = {Why Cryptosystems Fail in {ATM} Networks},\n}"
+	gotExpected(entry.Formatted(Format{Protection: ProtectSmart, Case: CaseTitle}), expected, false, t)
+
+	expected = "@online{key,\n\tauthor = \"\",\n\ttitle = {{Why cryptosystems fail in {ATM} networks}},\n}"
+	gotExpected(entry.Formatted(Format{Case: CaseSentence}), expected, false, t)
+}
+
+func TestFormatCanonical(t *testing.T) {
+	file, err := ParseBibTeXFile(strings.NewReader(bibtexFile), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(file.Entries[0].Comment, "Text outside the entries, like foo@example.com, is ignored.\n@string{acm = \"ACM Press\"}\n@comment{@article{commented, title = {No}}}\n@preamble{\"\\newcommand{\\noop}[1]{}\"}", false, t)
+	gotExpected(file.Entries[1].Comment, "", false, t)
+
+	format := Format{
+		Protection:      ProtectKeep,
+		Indent:          "  ",
+		Align:           true,
+		Braces:          true,
+		FieldOrder:      CanonicalFieldOrder,
+		MonthMacros:     true,
+		NoTrailingComma: true,
+		OmitEmpty:       true,
+	}
+	expected := `@article{wcf,
+  author    = {Ross Anderson and {Barnes and Noble}},
+  title     = {{Why Cryptosystems Fail}},
+  publisher = {ACM Press NY},
+  year      = {1994},
+  month     = jan,
+  urldate   = {2018-07-06}
+}`
+	gotExpected(file.Entries[0].Formatted(format), expected, false, t)
+
+	expected = `@misc{other,
+  title = {Other {Thing}},
+  year  = {in press}
+}`
+	gotExpected(file.Entries[1].Formatted(format), expected, false, t)
+
+	format.KeepMacros = true
+	expected = `@article{wcf,
+  author    = {Ross Anderson and {Barnes and Noble}},
+  title     = {{Why Cryptosystems Fail}},
+  publisher = acm # { NY},
+  year      = {1994},
+  month     = jan,
+  urldate   = {2018-07-06}
+}`
+	gotExpected(file.Entries[0].Formatted(format), expected, false, t)
+}
+
+func TestFormatMonth(t *testing.T) {
+	tests := map[string]string{
+		"jan":       "jan",
+		"{Jan}":     "{{Jan}}",
+		"September": "{September}",
+		"12":        "{12}",
+	}
+	for month, expected := range tests {
+		gotExpected(Format{}.month(month), expected, false, t)
+	}
+	for month, expected := range map[string]string{"Jan.": "jan", "September": "sep", "09": "sep", "12": "dec"} {
+		gotExpected(Format{MonthMacros: true}.month(month), expected, false, t)
+	}
+}
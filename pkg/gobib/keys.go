@@ -0,0 +1,175 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// KeyPolicy tells what to do when an entry has the key of a previous one.
+type KeyPolicy int
+
+const (
+	// KeysWarn warns about the duplicate keys, keeping them.
+	KeysWarn KeyPolicy = iota
+	// KeysDisambiguate adds a suffix to the duplicate keys.
+	KeysDisambiguate
+	// KeysError stops the conversion with ErrDuplicateKey.
+	KeysError
+)
+
+// KeyPolicies are the policies by name.
+var KeyPolicies = map[string]KeyPolicy{
+	"warn":         KeysWarn,
+	"disambiguate": KeysDisambiguate,
+	"error":        KeysError,
+}
+
+// keyStopWords are the title words skipped by the {title} placeholder.
+var keyStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "on": true, "of": true,
+	"in": true, "for": true, "and": true, "to": true, "with": true,
+}
+
+// accents maps the accented letters to their plain ones.
+var accents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o", "õ", "o", "ø", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n", "ß", "ss",
+)
+
+// keyPart turns s into something that can be part of a key:
+// lower case ASCII letters and digits only. TeX commands, like
+// the accents in 'M{\"u}ller', are removed.
+func keyPart(s string) string {
+	s = accents.Replace(strings.ToLower(s))
+
+	var part strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			// skipping the command name, or the accent symbol
+			i++
+			for i+1 < len(s) && s[i] >= 'a' && s[i] <= 'z' && s[i+1] >= 'a' && s[i+1] <= 'z' {
+				i++
+			}
+		case s[i] >= 'a' && s[i] <= 'z', s[i] >= '0' && s[i] <= '9':
+			part.WriteByte(s[i])
+		}
+	}
+	return part.String()
+}
+
+// Surname returns the surname of an author, both when
+// written 'First Last' and 'Last, First'.
+func Surname(author string) string {
+	author = strings.TrimSpace(author)
+	if comma := strings.Index(author, ","); comma != -1 {
+		return strings.TrimSpace(author[:comma])
+	}
+	fields := strings.Fields(author)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// titleWord returns the first significant word of a title.
+func titleWord(title string) string {
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '-' || r == ':'
+	}) {
+		part := keyPart(word)
+		if part != "" && !keyStopWords[part] {
+			return part
+		}
+	}
+	return ""
+}
+
+// GenKeyFromPattern generates, sets, returns a new key for this
+// entry using a pattern. The pattern placeholders are replaced by:
+//
+//	{author} the surname of the first author
+//	{authors} the surnames of the first three authors
+//	{year} the year
+//	{title} the first significant word of the title
+//	{key} the current key
+//
+// Anything else is copied as it is, e.g. '{author}{year}{title}'
+// generates 'anderson1994why'. When the placeholders are all empty,
+// leaving no letter or digit, the key is generated by GenKey.
+func (b *Entry) GenKeyFromPattern(pattern string) string {
+	var surnames []string
+	for i, author := range b.Authors {
+		if i == 3 {
+			break
+		}
+		surnames = append(surnames, keyPart(Surname(author)))
+	}
+
+	var first, year string
+	if len(surnames) > 0 {
+		first = surnames[0]
+	}
+	if firstYear := b.FirstYear(); firstYear != emptyYear {
+		year = strconv.Itoa(firstYear)
+	}
+
+	key := strings.NewReplacer(
+		"{author}", first,
+		"{authors}", strings.Join(surnames, ""),
+		"{year}", year,
+		"{title}", titleWord(b.Title),
+		"{key}", b.Key,
+	).Replace(pattern)
+	if strings.IndexFunc(key, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) == -1 {
+		// e.g. '{author}-{year}' with neither
+		return b.GenKey()
+	}
+	b.Key = key
+	return key
+}
+
+// uniqueKey checks that the key of entry isn't used by a previous
+// one. A generated key is always made unique adding a suffix, for the
+// others what happens depends on the config.
+func (c *Tex2BibConverter) uniqueKey(entry *Entry, generated bool) error {
+	if c.usedKeys[entry.Key] {
+		switch {
+		case generated:
+			entry.Key = suffixedKey(entry.Key, c.usedKeys)
+		case c.config.DuplicateKeys == KeysDisambiguate:
+			key := suffixedKey(entry.Key, c.usedKeys)
+			c.warnf("%s is already used, renamed to %s", entry.Key, key)
+			entry.Key = key
+		case c.config.DuplicateKeys == KeysError:
+			return fmt.Errorf("%s: %w", entry.Key, ErrDuplicateKey)
+		default:
+			c.warnf("%s is used by more than one entry", entry.Key)
+		}
+	}
+	c.usedKeys[entry.Key] = true
+	return nil
+}
@@ -0,0 +1,156 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const duplicateKeysBibliography = `\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, 1994
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Don't Fail, 1994
+\bibitem{} Foo Bar, Title, 2018
+\bibitem{} Foo Bar, Title, 2018
+\end{thebibliography}
+`
+
+func TestKeyPart(t *testing.T) {
+	tests := map[string]string{
+		"Anderson":      "anderson",
+		"M{\\\"u}ller":  "muller",
+		"Müller":        "muller",
+		"O'Neil-Smith":  "oneilsmith",
+		"\\textbf{Bar}": "bar",
+	}
+	for s, expected := range tests {
+		gotExpected(keyPart(s), expected, false, t)
+	}
+}
+
+func TestSurname(t *testing.T) {
+	tests := map[string]string{
+		"Ross Anderson":  "Anderson",
+		"Anderson, Ross": "Anderson",
+		"R. J. Anderson": "Anderson",
+		" Anderson ":     "Anderson",
+		"":               "",
+	}
+	for author, expected := range tests {
+		gotExpected(Surname(author), expected, false, t)
+	}
+}
+
+func TestGenKeyFromPattern(t *testing.T) {
+	entry := NewEntry("wcf", []string{"Ross Anderson", "Asking Alexandria"}, "The Why of Cryptosystems", 1994, "", nil)
+	tests := map[string]string{
+		"{author}{year}{title}": "anderson1994why",
+		"{authors}:{year}":      "andersonalexandria:1994",
+		"{key}-{year}":          "wcf-1994",
+	}
+	for pattern, expected := range tests {
+		entry.Key = "wcf"
+		gotExpected(entry.GenKeyFromPattern(pattern), expected, false, t)
+		gotExpected(entry.Key, expected, false, t)
+	}
+}
+
+func TestGenKeyFromPatternEmpty(t *testing.T) {
+	entry := NewEntry("wcf", nil, "Why Cryptosystems Fail", emptyYear, "", nil)
+	gotExpected(entry.GenKeyFromPattern("{author}-{year}"), "Why Cryptosystems Fail-0-", false, t)
+
+	list := `\begin{references}
+Why Cryptosystems Fail
+
+Why Cryptosystems Don't Fail
+
+Why Cryptosystems Fail
+\end{references}
+`
+	entries, err := ReadEntries(&Config{Input: strings.NewReader(list), KeyPattern: "{author}{year}"})
+	if err != nil {
+		t.Fatalf("Fail to read: %s", err)
+	}
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	gotExpected(strings.Join(keys, "|"), "Why Cryptosystems Fail-0-|Why Cryptosystems Don't Fail-0-|Why Cryptosystems Fail-0-b", false, t)
+}
+
+func TestKeyMap(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output:     &writer,
+		Input:      strings.NewReader(bib),
+		KeyPattern: "{author}{year}",
+	}
+	converter := initConverter(config)
+	converter.Converter.Convert()
+	<-converter.Converter.OkChan()
+
+	keys := converter.Converter.KeyMap()
+	expected := map[string]string{
+		"wcf":  "anderson1909",
+		"wcdf": "anderson",
+		"aass": "alexandria2011",
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Mismatch length: %v", keys)
+	}
+	for key, newKey := range expected {
+		gotExpected(keys[key], newKey, false, t)
+	}
+}
+
+func duplicateKeys(policy KeyPolicy) ([]string, string, error) {
+	var warnings strings.Builder
+	entries, err := ReadEntries(&Config{
+		Input:         strings.NewReader(duplicateKeysBibliography),
+		Warnings:      &warnings,
+		DuplicateKeys: policy,
+	})
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	return keys, warnings.String(), err
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	keys, warnings, err := duplicateKeys(KeysWarn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(strings.Join(keys, ","), "wcf,wcf,Title-2018-Foo Bar,Title-2018-Foo Barb", false, t)
+	gotExpected(warnings, "warning: wcf is used by more than one entry\n", false, t)
+
+	keys, warnings, err = duplicateKeys(KeysDisambiguate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(strings.Join(keys, ","), "wcf,wcfb,Title-2018-Foo Bar,Title-2018-Foo Barb", false, t)
+	gotExpected(warnings, "warning: wcf is already used, renamed to wcfb\n", false, t)
+
+	keys, _, err = duplicateKeys(KeysError)
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("Expected ErrDuplicateKey, got %v", err)
+	}
+	gotExpected(strings.Join(keys, ","), "wcf", false, t)
+}
@@ -0,0 +1,47 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+// Library is a Resolver looking the entries up in trusted
+// bibliographies, like a curated master.bib: an entry is found
+// when it's a duplicate of a library one, see IsDuplicate. When
+// more than one matches, the first one is taken.
+type Library struct {
+	entries []*Entry
+}
+
+// NewLibrary returns the library of entries.
+func NewLibrary(entries []*Entry) *Library {
+	return &Library{entries: entries}
+}
+
+// Resolve returns a copy of the library entry matching entry.
+func (l *Library) Resolve(entry *Entry) (*Entry, error) {
+	for _, candidate := range l.entries {
+		if ok, _ := IsDuplicate(entry, candidate); ok {
+			found := *candidate
+			found.Authors = append([]string(nil), candidate.Authors...)
+			found.Fields = make(map[string]string)
+			for field, value := range candidate.Fields {
+				found.Fields[field] = value
+			}
+			return &found, nil
+		}
+	}
+	return nil, ErrNotResolved
+}
@@ -0,0 +1,161 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const masterBib = `@article{anderson1994,
+  author = {Ross Anderson},
+  title = {Why Cryptosystems Fail},
+  journal = {Communications of the ACM},
+  year = 1994,
+  pages = {32--40},
+}
+
+@book{knuth1984,
+  author = {Donald E. Knuth},
+  title = {The {TeX}book},
+  publisher = {Addison-Wesley},
+  year = 1984,
+}
+`
+
+const libraryBibliography = `
+\begin{thebibliography}{9}
+\bibitem{wcf} R. Anderson, Why cryptosystems fail!, \url{example.com/wcf.pdf}
+\bibitem{texbook} D. Knuth, The TeXbook, 1984
+\bibitem{other} Someone Else, Whatever, 2000
+\end{thebibliography}
+`
+
+const expectedLibraryMerge = `@article{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1994",
+	url = {example.com/wcf.pdf},
+	journal = {Communications of the ACM},
+	pages = {32--40},
+}
+
+@book{texbook,
+	author = "Donald E. Knuth",
+	title = {{The {TeX}book}},
+	year = "1984",
+	publisher = {Addison-Wesley},
+}
+
+@online{other,
+	author = "Someone Else",
+	title = {{Whatever}},
+	year = "2000",
+}
+
+`
+
+const expectedLibrarySubstitute = `@article{anderson1994,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1994",
+	journal = {Communications of the ACM},
+	pages = {32--40},
+}
+
+@book{knuth1984,
+	author = "Donald E. Knuth",
+	title = {{The {TeX}book}},
+	year = "1984",
+	publisher = {Addison-Wesley},
+}
+
+@online{other,
+	author = "Someone Else",
+	title = {{Whatever}},
+	year = "2000",
+}
+
+`
+
+func testLibrary(t *testing.T) *Library {
+	entries, err := ParseBibTeX(strings.NewReader(masterBib), "master.bib")
+	if err != nil {
+		t.Fatalf("Fail to parse the library: %s", err)
+	}
+	return NewLibrary(entries)
+}
+
+func TestLibraryResolve(t *testing.T) {
+	library := testLibrary(t)
+	found, err := library.Resolve(NewEntry("x", []string{"Ross J. Anderson"}, "Why Cryptosystems Fail", 0, "", nil))
+	if err != nil || found.Key != "anderson1994" || found.Source.String() != "master.bib:1" {
+		t.Fatalf("Wrong entry: %v %v", found, err)
+	}
+	// the library isn't changed through the copy
+	found.Fields["pages"] = "1--2"
+	if again, _ := library.Resolve(found); again.Fields["pages"] != "32--40" {
+		t.Errorf("The library is changed: %s", again)
+	}
+
+	for _, entry := range []*Entry{
+		NewEntry("x", []string{"Ross Anderson"}, "Why Cryptosystems Fail", 1995, "", nil),
+		NewEntry("x", []string{"Someone Else"}, "Why Cryptosystems Fail", 1994, "", nil),
+		NewEntry("x", []string{"Ross Anderson"}, "Security Engineering", 1994, "", nil),
+	} {
+		if _, err = library.Resolve(entry); !errors.Is(err, ErrNotResolved) {
+			t.Errorf("Wrong error for %s: %v", entry, err)
+		}
+	}
+}
+
+func TestCompleteLibraryMerge(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output:   &writer,
+		Input:    strings.NewReader(libraryBibliography),
+		Resolver: testLibrary(t),
+	}
+	runTestComplete(config, expectedLibraryMerge, t)
+}
+
+func TestCompleteLibrarySubstitute(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output:       &writer,
+		Input:        strings.NewReader(libraryBibliography),
+		Resolver:     Resolvers{testLibrary(t), testResolver},
+		ResolveMode:  ResolveSubstitute,
+		ResolvedKeys: true,
+		KeyPattern:   "{key}",
+	}
+	runTestComplete(config, expectedLibrarySubstitute, t)
+
+	config.Input, config.Output = strings.NewReader(libraryBibliography), &strings.Builder{}
+	converter := NewConverter(config)
+	if err := converter.Run(); err != nil {
+		t.Fatalf("Fail to run: %s", err)
+	}
+	keyMap := converter.KeyMap()
+	if len(keyMap) != 2 || keyMap["wcf"] != "anderson1994" || keyMap["texbook"] != "knuth1984" {
+		t.Errorf("Wrong key map: %v", keyMap)
+	}
+	sources := converter.Entries()[0].FieldSources()
+	gotExpected(sources["pages"].String(), "master.bib:1", false, t)
+}
@@ -0,0 +1,374 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Severity tells how bad a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityError is for the entries BibTeX can't use.
+	SeverityError Severity = iota
+	// SeverityWarning is for the likely mistakes.
+	SeverityWarning
+	// SeverityInfo is for what may be improved.
+	SeverityInfo
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "info"
+}
+
+// MarshalText returns the name of the severity, for JSON.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText sets the severity from its name.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		if severity.String() == string(text) {
+			*s = severity
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Diagnostic is a problem found in an entry by Validate.
+type Diagnostic struct {
+	// Rule is the name of the check that failed, e.g. 'required-field'
+	Rule string `json:"rule"`
+	// Severity tells how bad the problem is
+	Severity Severity `json:"severity"`
+	// Key is the key of the entry
+	Key string `json:"key"`
+	// Field is the field having the problem, if any
+	Field string `json:"field,omitempty"`
+	// Message describes the problem
+	Message string `json:"message"`
+	// Source is where the entry was read from
+	Source Source `json:"source"`
+}
+
+// String returns the diagnostic as 'file:line: severity: key: message (rule)'.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s: %s (%s)", d.Source, d.Severity, d.Key, d.Message, d.Rule)
+}
+
+// entryFields are the fields used by an entry type. A required
+// field may have alternatives, separated by '|'.
+type entryFields struct {
+	required []string
+	optional []string
+}
+
+// entryTypes are the BibTeX entry types, and the biblatex ones
+// used by gobib, with their fields.
+var entryTypes = map[string]entryFields{
+	"article": {
+		required: []string{"author", "title", "journal|journaltitle", "year|date"},
+		optional: []string{"volume", "number", "pages", "month"},
+	},
+	"book": {
+		required: []string{"author|editor", "title", "publisher", "year|date"},
+		optional: []string{"volume", "number", "series", "address", "edition", "month"},
+	},
+	"booklet": {
+		required: []string{"title"},
+		optional: []string{"author", "howpublished", "address", "month", "year"},
+	},
+	"inbook": {
+		required: []string{"author|editor", "title", "chapter|pages", "publisher", "year|date"},
+		optional: []string{"volume", "number", "series", "type", "address", "edition", "month"},
+	},
+	"incollection": {
+		required: []string{"author", "title", "booktitle", "publisher", "year|date"},
+		optional: []string{"editor", "volume", "number", "series", "type", "chapter", "pages", "address", "edition", "month"},
+	},
+	"inproceedings": {
+		required: []string{"author", "title", "booktitle", "year|date"},
+		optional: []string{"editor", "volume", "number", "series", "pages", "address", "month", "organization", "publisher"},
+	},
+	"manual": {
+		required: []string{"title"},
+		optional: []string{"author", "organization", "address", "edition", "month", "year"},
+	},
+	"mastersthesis": {
+		required: []string{"author", "title", "school", "year|date"},
+		optional: []string{"type", "address", "month"},
+	},
+	"misc": {
+		optional: []string{"author", "title", "howpublished", "month", "year"},
+	},
+	"online": {
+		required: []string{"author|editor", "title", "year|date", "url"},
+		optional: []string{"subtitle", "organization", "month", "version"},
+	},
+	"phdthesis": {
+		required: []string{"author", "title", "school", "year|date"},
+		optional: []string{"type", "address", "month"},
+	},
+	"proceedings": {
+		required: []string{"title", "year|date"},
+		optional: []string{"editor", "volume", "number", "series", "address", "month", "organization", "publisher"},
+	},
+	"techreport": {
+		required: []string{"author", "title", "institution", "year|date"},
+		optional: []string{"type", "number", "address", "month"},
+	},
+	"unpublished": {
+		required: []string{"author", "title", "note"},
+		optional: []string{"month", "year"},
+	},
+}
+
+// commonFields are the fields any entry type may have.
+var commonFields = []string{
+	"url", "urldate", "doi", "note", "key", "crossref", "abstract", "keywords",
+	"isbn", "issn", "language", "annote", "file", "eprint", "eprinttype",
+	"pubstate", "date", "addendum",
+}
+
+// conference is the old name of inproceedings.
+func init() {
+	entryTypes["conference"] = entryTypes["inproceedings"]
+}
+
+// keyRegexp matches the keys made of safe characters only.
+var keyRegexp = regexp.MustCompile(`^[A-Za-z0-9_:./+-]+$`)
+
+// isoDateRegexp matches an ISO 8601 date, or a range of dates.
+var isoDateRegexp = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?(/(\d{4}(-\d{2}(-\d{2})?)?)?)?$`)
+
+// doiFormatRegexp matches a well formed DOI.
+var doiFormatRegexp = regexp.MustCompile(`^10\.\d{4,9}/\S+$`)
+
+// firstWebYear is the first year an URL makes sense.
+const firstWebYear = 1990
+
+// Linter tells how Linter.Validate checks the entries.
+type Linter struct {
+	// MinYear is the year before which any year is suspicious,
+	// the online entries have firstWebYear too
+	MinYear int
+}
+
+// DefaultLinter is the Linter used by Validate.
+var DefaultLinter = Linter{MinYear: 1950}
+
+// fieldValue returns the value of a field of the entry,
+// as it's written, and if it's present.
+func (b *Entry) fieldValue(field string) (string, bool) {
+	switch field {
+	case "author":
+		return b.AuthorsToString(), len(b.Authors) > 0
+	case "title":
+		return b.Title, b.Title != emptyString
+	case "year":
+		if b.Year != emptyYear {
+			return fmt.Sprint(b.Year), true
+		}
+	case "url":
+		return b.URL, b.URL != emptyString
+	case "urldate":
+		if b.Visited != nil {
+			return b.Visited.Format("2006-01-02"), true
+		}
+	}
+	value, ok := b.Fields[field]
+	return value, ok
+}
+
+// Validate checks an entry, returning the problems found: the
+// required fields of its type missing, the fields not used by
+// its type, unbalanced braces, bad characters in the key, dates
+// not in ISO 8601 format, suspicious years, malformed URLs and
+// DOIs, and all-caps titles that BibTeX styles will lowercase.
+// It uses DefaultLinter.
+func Validate(entry *Entry) []Diagnostic {
+	return DefaultLinter.Validate(entry)
+}
+
+// Validate checks an entry like the Validate function, with the
+// settings of l.
+func (l Linter) Validate(entry *Entry) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(rule string, severity Severity, field, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Rule:     rule,
+			Severity: severity,
+			Key:      entry.Key,
+			Field:    field,
+			Message:  fmt.Sprintf(format, args...),
+			Source:   entry.Source,
+		})
+	}
+
+	switch {
+	case entry.Key == emptyString:
+		report("key-characters", SeverityError, "", "the key is empty")
+	case !keyRegexp.MatchString(entry.Key):
+		report("key-characters", SeverityError, "", "the key %q has characters BibTeX or LaTeX can't handle", entry.Key)
+	}
+
+	entryType := strings.ToLower(entry.Type)
+	if entryType == emptyString {
+		entryType = "online"
+	}
+	fields, known := entryTypes[entryType]
+	if !known {
+		report("unknown-type", SeverityWarning, "", "@%s is not a standard entry type", entryType)
+	}
+
+	used := make(map[string]bool)
+	for _, field := range commonFields {
+		used[field] = true
+	}
+	for _, field := range fields.optional {
+		used[field] = true
+	}
+	for _, required := range fields.required {
+		alternatives := strings.Split(required, "|")
+		present := false
+		for _, field := range alternatives {
+			used[field] = true
+			_, ok := entry.fieldValue(field)
+			present = present || ok
+		}
+		if !present {
+			report("required-field", SeverityError, alternatives[0], "@%s requires %s", entryType, strings.Join(alternatives, " or "))
+		}
+	}
+
+	for _, field := range entry.FieldNames() {
+		value, _ := entry.fieldValue(field)
+		if known && !used[field] {
+			report("unused-field", SeverityInfo, field, "%s is not used by @%s", field, entryType)
+		}
+		if !balancedBraces(value) {
+			report("unbalanced-braces", SeverityError, field, "%s has unbalanced braces", field)
+		}
+	}
+
+	for _, field := range []string{"date", "urldate", "eventdate", "origdate"} {
+		if value, ok := entry.Fields[field]; ok && !isoDateRegexp.MatchString(value) {
+			report("date-format", SeverityWarning, field, "%s %q is not an ISO 8601 date (YYYY-MM-DD)", field, value)
+		}
+	}
+	if entry.urldate != emptyString {
+		report("date-format", SeverityWarning, "urldate", "urldate %q is not an ISO 8601 date (YYYY-MM-DD)", entry.urldate)
+	}
+
+	// a range of years, like 2017--2018, is a year too
+	if value, ok := entry.Fields["year"]; ok && !rangeRegexp.MatchString(value) {
+		report("suspicious-year", SeverityWarning, "year", "year %q is not a number", value)
+	} else if year := entry.FirstYear(); year != emptyYear {
+		switch next := time.Now().Year() + 1; {
+		case year > next:
+			report("suspicious-year", SeverityWarning, "year", "year %d is in the future", year)
+		case year < firstWebYear && (entry.URL != emptyString || entryType == "online"):
+			report("suspicious-year", SeverityWarning, "year", "year %d is before the web, but the entry is online", year)
+		case year < l.MinYear:
+			report("suspicious-year", SeverityWarning, "year", "year %d is before %d", year, l.MinYear)
+		}
+	}
+
+	if entry.URL != emptyString {
+		if parsed, err := url.Parse(entry.URL); err != nil {
+			report("url-format", SeverityWarning, "url", "url is malformed: %s", err.Error())
+		} else if parsed.Scheme == emptyString || parsed.Host == emptyString {
+			report("url-format", SeverityWarning, "url", "url %q has no scheme or host", entry.URL)
+		}
+	}
+
+	if doi, ok := entry.Fields["doi"]; ok && !doiFormatRegexp.MatchString(entry.DOI()) {
+		report("doi-format", SeverityWarning, "doi", "doi %q is malformed", doi)
+	}
+
+	if isAllCaps(entry.Title) {
+		report("all-caps-title", SeverityWarning, "title", "the title is in all caps without braces, styles will lowercase it")
+	}
+	return diagnostics
+}
+
+// balancedBraces tells if the braces of s are balanced.
+func balancedBraces(s string) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// isAllCaps tells if the letters of a title outside the braces
+// are all upper case, and there's more than a word of them.
+func isAllCaps(title string) bool {
+	var unprotected strings.Builder
+	depth := 0
+	for _, r := range title {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+		case depth == 0:
+			unprotected.WriteRune(r)
+		}
+	}
+
+	words := 0
+	for _, word := range strings.Fields(unprotected.String()) {
+		letters := false
+		for _, r := range word {
+			if unicode.IsLower(r) {
+				return false
+			}
+			letters = letters || unicode.IsUpper(r)
+		}
+		if letters {
+			words++
+		}
+	}
+	return words > 1
+}
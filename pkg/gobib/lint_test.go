@@ -0,0 +1,152 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+const lintFile = `@article{good,
+  author = {Ross Anderson},
+  title = {Why Cryptosystems Fail},
+  journal = {Communications of the ACM},
+  year = 1994,
+  doi = {10.1145/188280.188291},
+}
+
+@article{bad key,
+  author = {Ross Anderson},
+  title = {WHY CRYPTOSYSTEMS FAIL},
+  year = 1909,
+  url = {example.com/wcf},
+  doi = {not a doi},
+  urldate = {6/7/2018},
+  color = {blue},
+}
+
+@online{future,
+  author = {Foo Bar},
+  title = {{WHY CRYPTOSYSTEMS FAIL} and {NSA}},
+  year = 3000,
+  url = {https://example.com},
+}
+
+@thing{odd,
+  title = {Unbalanced \{ brace}},
+}
+`
+
+func lintRules(diagnostics []Diagnostic) string {
+	var rules []string
+	for _, diagnostic := range diagnostics {
+		rule := diagnostic.Rule
+		if diagnostic.Field != "" {
+			rule += ":" + diagnostic.Field
+		}
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, " ")
+}
+
+func TestValidate(t *testing.T) {
+	entries, err := ParseBibTeX(strings.NewReader(lintFile), "lint.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"",
+		"all-caps-title:title date-format:urldate doi-format:doi key-characters required-field:journal suspicious-year:year unused-field:color url-format:url",
+		"suspicious-year:year",
+		"unbalanced-braces:title unknown-type",
+	}
+	for i, entry := range entries {
+		gotExpected(lintRules(Validate(entry)), expected[i], false, t)
+	}
+
+	diagnostics := Validate(entries[0])
+	if len(diagnostics) != 0 {
+		t.Fatalf("Unexpected diagnostics: %v", diagnostics)
+	}
+	diagnostics = Validate(entries[2])
+	gotExpected(diagnostics[0].String(), "lint.bib:19: warning: future: year 3000 is in the future (suspicious-year)", false, t)
+}
+
+func TestValidateConverted(t *testing.T) {
+	entries, err := ReadEntries(&Config{Input: strings.NewReader(bib)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the wcf entry of 1909 has an URL without scheme,
+	// the others have neither a year nor an URL
+	gotExpected(lintRules(Validate(entries[0])), "suspicious-year:year url-format:url", false, t)
+	gotExpected(lintRules(Validate(entries[1])), "required-field:url required-field:year", false, t)
+}
+
+const lintYears = `@article{old,
+  author = {Ross Anderson},
+  title = {Why Cryptosystems Fail},
+  journal = {Communications of the ACM},
+  year = 1909,
+  urldate = {2018-7-6},
+}
+
+@article{range,
+  author = {Ross Anderson},
+  title = {Why Cryptosystems Fail},
+  journal = {Communications of the ACM},
+  year = {2017--2018},
+}
+
+@article{date,
+  author = {Ross Anderson},
+  title = {Why Cryptosystems Fail},
+  journal = {Communications of the ACM},
+  date = {1909-06},
+}
+`
+
+func TestValidateYears(t *testing.T) {
+	entries, err := ParseBibTeX(strings.NewReader(lintYears), "lint.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(lintRules(Validate(entries[0])), "date-format:urldate suspicious-year:year", false, t)
+	gotExpected(lintRules(Validate(entries[1])), "", false, t)
+	gotExpected(lintRules(Validate(entries[2])), "suspicious-year:year", false, t)
+
+	linter := Linter{MinYear: 1900}
+	gotExpected(lintRules(linter.Validate(entries[0])), "date-format:urldate", false, t)
+}
+
+func TestSeverityText(t *testing.T) {
+	for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		text, _ := severity.MarshalText()
+		var got Severity
+		if err := got.UnmarshalText(text); err != nil || got != severity {
+			t.Errorf("%s: got %s, %v", text, got, err)
+		}
+	}
+	var severity Severity
+	if err := severity.UnmarshalText([]byte("fatal")); err == nil {
+		t.Error("Expected an error for an unknown severity")
+	}
+}
@@ -0,0 +1,206 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// BeginReferences is the constant: '\begin{references}'
+	BeginReferences = "\\begin{references}"
+	// EndReferences is the constant: '\end{references}'
+	EndReferences = "\\end{references}"
+	// BeginEnumerate is the constant: '\begin{enumerate}'
+	BeginEnumerate = "\\begin{enumerate}"
+	// EndEnumerate is the constant: '\end{enumerate}'
+	EndEnumerate = "\\end{enumerate}"
+	// Item is the constant that represents '\item'
+	Item = "\\item"
+)
+
+// lists are the \bibitem-less lists of references
+// that are supported, each one with its end.
+var lists = [][2]string{
+	{BeginReferences, EndReferences},
+	{BeginEnumerate, EndEnumerate},
+}
+
+// sectionRegexp matches a sectioning command, like '\section*{References}'.
+var sectionRegexp = regexp.MustCompile(`\\(?:part|chapter|section|subsection|subsubsection|paragraph)\*?(?:\[[^\]]*\])?\{([^}]*)\}`)
+
+// headingRegexp matches a line which is a heading by itself,
+// without a sectioning command, like '\textbf{References}' or
+// 'Bibliography:'.
+var headingRegexp = regexp.MustCompile(`^\s*(?:\\noindent\s*)?(?:\\(?:textbf|textsc|emph|large|Large|underline)\s*\{|\{\\(?:bf|sc|large|Large)\s+)?([A-Za-z ]{1,30}?)\s*:?\s*\}?\s*(?:\\\\)?\s*$`)
+
+// referencesRegexp matches the titles usually given to the
+// section holding the references.
+var referencesRegexp = regexp.MustCompile(`(?i)reference|bibliograph|literature|works cited|sources`)
+
+// seeSection keeps track of the title of the last section,
+// or of the last heading like the references usually have.
+func (c *Tex2BibConverter) seeSection(line string) {
+	if match := sectionRegexp.FindStringSubmatch(line); match != nil {
+		c.section = match[1]
+	} else if match := headingRegexp.FindStringSubmatch(line); match != nil && referencesRegexp.MatchString(match[1]) {
+		c.section = match[1]
+	}
+}
+
+// listEnd returns the end of the list that begins in line,
+// or an empty string if no list begins here. An enumerate is
+// a list of references only when it follows a section or a
+// heading like 'References', since a document may have any
+// other enumerate before them.
+func (c *Tex2BibConverter) listEnd(line string) string {
+	for _, list := range lists {
+		if !strings.Contains(line, list[0]) {
+			continue
+		}
+		if list[0] == BeginEnumerate && !referencesRegexp.MatchString(c.section) {
+			return ""
+		}
+		return list[1]
+	}
+	return ""
+}
+
+// listBegin returns the beginning of the list ending with end.
+func listBegin(end string) string {
+	for _, list := range lists {
+		if list[1] == end {
+			return list[0]
+		}
+	}
+	return ""
+}
+
+// cutItem tells if line begins a new '\item' and returns what
+// follows it, without the optional '[label]'.
+func cutItem(line string) (string, bool) {
+	if !strings.HasPrefix(line, Item) {
+		return line, false
+	}
+	rest := line[len(Item):]
+	if r, _ := utf8.DecodeRuneInString(rest); unicode.IsLetter(r) {
+		// it's another command, like '\itemsep'
+		return line, false
+	}
+	if strings.HasPrefix(rest, "[") {
+		// the label may contain brackets inside braces, like '[{[1]}]'
+		depth := 0
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '{' {
+				depth++
+			} else if rest[i] == '}' {
+				depth--
+			} else if rest[i] == ']' && depth == 0 {
+				rest = rest[i+1:]
+				break
+			}
+		}
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// divideList is the divider loop for a list of references
+// without \bibitem, it reads till end. Each reference starts
+// with '\item' or '\bibitem'; when neither is used the
+// references are separated by blank lines. The lists nested
+// inside a reference are part of it.
+func (c *Tex2BibConverter) divideList(end string) error {
+	begin := listBegin(end)
+	depth := 0
+	var currentEntry strings.Builder
+	var currentResult dividerResult
+
+	// send pushes the current entry, if any, and resets it
+	send := func() {
+		if currentEntry.Len() > 0 {
+			currentResult.value = currentEntry.String()
+			c.emit(currentResult)
+		}
+		currentEntry.Reset()
+		currentResult = dividerResult{}
+	}
+
+	// startItem sends the previous item, anything that comes
+	// before the first item is not a reference and it's discarded
+	items := false
+	startItem := func() {
+		if !items {
+			currentEntry.Reset()
+		}
+		items = true
+		send()
+	}
+
+	for {
+		line, _, err := c.reader.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				err = ErrBibUnclosed
+			}
+			send()
+			return err
+		}
+
+		readLine := strings.TrimSpace(string(line))
+		depth += strings.Count(readLine, begin)
+		if strings.Contains(readLine, end) {
+			if depth == 0 {
+				send()
+				return nil
+			}
+			depth -= strings.Count(readLine, end)
+		}
+
+		if depth > 0 || strings.Contains(readLine, end) {
+			// inside a nested list, or right at its end: its
+			// items are part of the current reference
+			readLine = strings.NewReplacer(begin, "", end, "").Replace(readLine)
+			readLine, _ = cutItem(strings.TrimSpace(readLine))
+			c.writeLine(&currentEntry, readLine)
+			continue
+		}
+		if rest, ok := cutItem(readLine); ok {
+			startItem()
+			readLine = rest
+		} else if key, rest, ok := cutBibitem(readLine); ok {
+			startItem()
+			currentResult.key = key
+			readLine = rest
+		} else if readLine == "" && !items {
+			// blank lines separate the references
+			send()
+		}
+
+		if readLine != "" && currentEntry.Len() == 0 {
+			// the item begins here
+			key := currentResult.key
+			currentResult = c.newResult(key)
+		}
+		c.addComment(&currentResult)
+		c.writeLine(&currentEntry, readLine)
+	}
+}
@@ -0,0 +1,128 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+const enumerateBibliography = `
+\section*{References}
+\begin{enumerate}
+	\setlength{\itemsep}{0pt}
+	\item Ross Anderson, Why Cryptosystems Fail, 1994
+	\item[{[2]}] Asking Alexandria,
+	Someone Somewhere, 2011
+\end{enumerate}
+`
+
+const referencesBibliography = `
+\begin{references}
+Ross Anderson, Why Cryptosystems Fail, 1994
+
+Asking Alexandria,
+Someone Somewhere, 2011
+\end{references}
+`
+
+// documentEnumerate has an enumerate which is not a list of
+// references, and one nesting another list.
+const documentEnumerate = `\documentclass{article}
+\begin{document}
+\begin{enumerate}
+	\item First point, 2018
+\end{enumerate}
+
+\noindent\textbf{References:}
+\begin{enumerate}
+	\item Ross Anderson, Why Cryptosystems Fail, 1994
+	\item Asking Alexandria,
+	\begin{enumerate}
+		\item Someone Somewhere, 2011
+	\end{enumerate}
+\end{enumerate}
+\end{document}
+`
+
+const expectedListBib = `@online{Why Cryptosystems Fail-1994-Ross Anderson,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1994",
+}
+
+@online{Someone Somewhere-2011-Asking Alexandria,
+	author = "Asking Alexandria",
+	title = {{Someone Somewhere}},
+	year = "2011",
+}
+
+`
+
+func TestCutItem(t *testing.T) {
+	tests := []struct {
+		line, rest string
+		ok         bool
+	}{
+		{"\\item Foo, Bar", "Foo, Bar", true},
+		{"\\item[{[1]}] Foo", "Foo", true},
+		{"\\itemsep", "\\itemsep", false},
+		{"Foo", "Foo", false},
+	}
+	for _, test := range tests {
+		rest, ok := cutItem(test.line)
+		if ok != test.ok {
+			t.Errorf("Fail to check %s", test.line)
+		}
+		gotExpected(rest, test.rest, false, t)
+	}
+}
+
+func TestCompleteEnumerate(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(enumerateBibliography),
+	}
+	runTestComplete(config, expectedListBib, t)
+}
+
+func TestCompleteReferences(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(referencesBibliography),
+	}
+	runTestComplete(config, expectedListBib, t)
+}
+
+func TestCompleteDocumentEnumerate(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(documentEnumerate),
+	}
+	runTestComplete(config, expectedListBib, t)
+}
+
+func TestEnumerateWithoutReferences(t *testing.T) {
+	entries, err := ReadEntries(&Config{Input: strings.NewReader("\\begin{enumerate}\n\\item First point, 2018\n\\end{enumerate}\n")})
+	if err != ErrBibEmpty {
+		t.Errorf("Expected ErrBibEmpty, got %v, %v", err, entries)
+	}
+}
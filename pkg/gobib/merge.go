@@ -0,0 +1,152 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"sort"
+	"strconv"
+)
+
+// KeyChange is a key changed to make it unique.
+type KeyChange struct {
+	// Old is the original key
+	Old string
+	// New is the key given to the entry
+	New string
+	// Source is where the renamed entry was read from
+	Source Source
+}
+
+// suffixedKey returns key with the first suffix, among 'b' to 'z'
+// and then the numbers from 2, making it not used. key is never
+// empty, the empty keys are generated before.
+func suffixedKey(key string, used map[string]bool) string {
+	for suffix := 'b'; suffix <= 'z'; suffix++ {
+		if candidate := key + string(suffix); !used[candidate] {
+			return candidate
+		}
+	}
+	for i := 2; ; i++ {
+		if candidate := key + strconv.Itoa(i); !used[candidate] {
+			return candidate
+		}
+	}
+}
+
+// DisambiguateKeys makes the keys of entries unique: the first entry
+// having a key keeps it, the following ones get a suffix. Since the
+// suffixed keys avoid any key already in entries, the result only
+// depends on their order. Empty keys are generated first. It returns
+// the keys changed, in order.
+func DisambiguateKeys(entries []*Entry) []KeyChange {
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Key == emptyString {
+			entry.GenKey()
+		}
+		used[entry.Key] = true
+	}
+
+	var changes []KeyChange
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if !seen[entry.Key] {
+			seen[entry.Key] = true
+			continue
+		}
+		key := suffixedKey(entry.Key, used)
+		changes = append(changes, KeyChange{Old: entry.Key, New: key, Source: entry.Source})
+		entry.Key = key
+		used[key] = true
+		seen[key] = true
+	}
+	return changes
+}
+
+// MergeEntries merges the entries of several bibliographies, given
+// in order: the duplicates are handled according to mode and policy,
+// then the remaining key collisions are solved by DisambiguateKeys.
+// It returns the merged entries, the duplicates found and the keys
+// changed.
+func MergeEntries(entries []*Entry, mode DedupMode, policy ConflictPolicy) ([]*Entry, []Duplicate, []KeyChange) {
+	result, duplicates := Dedup(entries, mode, policy)
+	changes := DisambiguateKeys(result)
+	return result, duplicates, changes
+}
+
+// fieldSource returns where a field of the entry was read from.
+func (b *Entry) fieldSource(field string) Source {
+	if source, ok := b.Provenance[field]; ok {
+		return source
+	}
+	return b.Source
+}
+
+// takeFrom records that a field of the entry was taken from src.
+func (b *Entry) takeFrom(field string, src *Entry) {
+	if b.Provenance == nil {
+		b.Provenance = make(map[string]Source)
+	}
+	b.Provenance[field] = src.fieldSource(field)
+}
+
+// FieldSources returns where each field of the entry was read
+// from, by the BibTeX field name.
+func (b *Entry) FieldSources() map[string]Source {
+	sources := make(map[string]Source)
+	for _, field := range b.FieldNames() {
+		sources[field] = b.fieldSource(field)
+	}
+	return sources
+}
+
+// FieldValues returns the fields of the entry, by BibTeX
+// name, as they're written.
+func (b *Entry) FieldValues() map[string]string {
+	values := make(map[string]string)
+	for _, field := range b.FieldNames() {
+		values[field], _ = b.fieldValue(field)
+	}
+	return values
+}
+
+// FieldNames returns the BibTeX names of the fields of
+// the entry, in the order they're written.
+func (b *Entry) FieldNames() []string {
+	var names []string
+	for _, field := range []struct {
+		name    string
+		present bool
+	}{
+		{"author", len(b.Authors) > 0},
+		{"title", b.Title != emptyString},
+		{"year", b.Year != emptyYear},
+		{"url", b.URL != emptyString},
+		{"urldate", b.Visited != nil},
+	} {
+		if field.present {
+			names = append(names, field.name)
+		}
+	}
+	var extra []string
+	for name := range b.Fields {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	return append(names, extra...)
+}
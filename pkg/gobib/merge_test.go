@@ -0,0 +1,72 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+const mergedTex = `\begin{thebibliography}{9}
+\bibitem{wcf2} Ross Anderson, Why Cryptosystems Fail, \url{example.com/wcf}, 1994
+\bibitem{other} Someone Else, A Different Thing, 2010
+\end{thebibliography}
+`
+
+func TestDisambiguateKeys(t *testing.T) {
+	entries := []*Entry{
+		{Key: "a"}, {Key: "a"}, {Key: "ab"}, {Key: "a"},
+	}
+	changes := DisambiguateKeys(entries)
+
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	gotExpected(strings.Join(keys, ","), "a,ac,ab,ad", false, t)
+	if len(changes) != 2 || changes[0].Old != "a" || changes[0].New != "ac" {
+		t.Errorf("Wrong changes: %v", changes)
+	}
+}
+
+func TestMergeEntries(t *testing.T) {
+	entries, err := ParseBibTeX(strings.NewReader(bibtexFile), "a.bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, err := ReadEntries(&Config{Input: strings.NewReader(mergedTex), Name: "b.tex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, duplicates, changes := MergeEntries(append(entries, converted...), DedupMerge, ConflictFirst)
+	if len(merged) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(merged))
+	}
+	if len(duplicates) != 1 || duplicates[0].Key != "wcf2" || duplicates[0].Of != "wcf" {
+		t.Errorf("Wrong duplicates: %v", duplicates)
+	}
+	if len(changes) != 1 || changes[0].New != "otherb" || changes[0].Source.String() != "b.tex:3" {
+		t.Errorf("Wrong changes: %v", changes)
+	}
+
+	sources := merged[0].FieldSources()
+	gotExpected(sources["title"].String(), "a.bib:6", false, t)
+	gotExpected(sources["url"].String(), "b.tex:2", false, t)
+	gotExpected(strings.Join(merged[0].FieldNames(), ","), "author,title,year,url,urldate,month,publisher", false, t)
+}
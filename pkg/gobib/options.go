@@ -0,0 +1,101 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrOption is returned by SetOption when the option is unknown
+// or its value is wrong.
+var ErrOption = errors.New("wrong option")
+
+// Options are the names of the options set by SetOption.
+var Options = []string{
+	"default-year",
+	"default-urldate",
+	"cited-order",
+	"key-pattern",
+	"dedup",
+	"dedup-conflict",
+	"duplicate-keys",
+	"title-protection",
+	"title-case",
+	"sort",
+	"group",
+	"dialect",
+}
+
+// SetOption sets an option of the config given its name, which
+// is the one of the command line flag, and its value as text,
+// e.g. SetOption("sort", "year"). It's meant for the options
+// coming from outside a program, like those of an HTTP request.
+func (c *Config) SetOption(name, value string) error {
+	var ok bool
+	switch name {
+	case "default-year":
+		year, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%w %s: %s", ErrOption, name, value)
+		}
+		c.DefaultYear = year
+		return nil
+	case "default-urldate":
+		visited, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return fmt.Errorf("%w %s: %s, the format is YYYY-MM-DD", ErrOption, name, value)
+		}
+		c.DefaultVisited = &visited
+		return nil
+	case "key-pattern":
+		c.KeyPattern = value
+		return nil
+	case "group":
+		group, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w %s: %s", ErrOption, name, value)
+		}
+		c.Group = group
+		return nil
+	case "cited-order":
+		c.CitedOrder, ok = CitationOrders[value]
+	case "dedup":
+		c.Dedup, ok = DedupModes[value]
+	case "dedup-conflict":
+		c.Conflict, ok = ConflictPolicies[value]
+	case "duplicate-keys":
+		c.DuplicateKeys, ok = KeyPolicies[value]
+	case "title-protection":
+		c.Format.Protection, ok = TitleProtections[value]
+	case "title-case":
+		c.Format.Case, ok = TitleCases[value]
+	case "sort":
+		c.Sort, ok = SortOrders[value]
+	case "dialect":
+		c.Dialect, ok = Dialects[value]
+	default:
+		return fmt.Errorf("%w: unknown option %s", ErrOption, name)
+	}
+	if !ok {
+		return fmt.Errorf("%w %s: %s", ErrOption, name, value)
+	}
+	return nil
+}
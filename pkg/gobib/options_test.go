@@ -0,0 +1,59 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetOption(t *testing.T) {
+	config := &Config{}
+	options := map[string]string{
+		"default-year":     "2018",
+		"default-urldate":  "2018-07-06",
+		"cited-order":      "alphabetical",
+		"key-pattern":      "{author}{year}",
+		"dedup":            "merge",
+		"dedup-conflict":   "longest",
+		"duplicate-keys":   "error",
+		"title-protection": "smart",
+		"title-case":       "sentence",
+		"sort":             "year-desc",
+		"group":            "true",
+		"dialect":          "biblatex",
+	}
+	for _, name := range Options {
+		if err := config.SetOption(name, options[name]); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+	if config.DefaultYear != 2018 || config.DefaultVisited.Format("2006-01-02") != "2018-07-06" ||
+		config.CitedOrder != OrderAlphabetical || config.KeyPattern != "{author}{year}" ||
+		config.Dedup != DedupMerge || config.Conflict != ConflictLongest || config.DuplicateKeys != KeysError ||
+		config.Format.Protection != ProtectSmart || config.Format.Case != CaseSentence ||
+		config.Sort != SortYearDesc || !config.Group || config.Dialect != DialectBibLaTeX {
+		t.Errorf("Wrong config: %+v", config)
+	}
+
+	for name, value := range map[string]string{"sort": "color", "default-year": "soon", "group": "maybe", "color": "blue"} {
+		if err := config.SetOption(name, value); !errors.Is(err, ErrOption) {
+			t.Errorf("%s=%s: expected ErrOption, got %v", name, value, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import "errors"
+
+// ErrNotResolved is an error that is returned by a Resolver
+// when it finds no metadata for an entry
+var ErrNotResolved = errors.New("no metadata found")
+
+// Resolver completes the entries with authoritative metadata,
+// e.g. from Crossref. Resolve gets an entry as parsed, whose
+// title, authors, year and DOI may be all there is, and returns
+// the entry as the resolver knows it: its type, canonical title,
+// venue, volume, pages and so on. The returned entry should have
+// as Source where its metadata comes from. When nothing is found
+// ErrNotResolved is returned.
+type Resolver interface {
+	Resolve(entry *Entry) (*Entry, error)
+}
+
+// Resolvers is a Resolver asking each resolver in turn,
+// until one finds the entry.
+type Resolvers []Resolver
+
+// Resolve returns the entry found by the first resolver
+// finding it.
+func (r Resolvers) Resolve(entry *Entry) (*Entry, error) {
+	for _, resolver := range r {
+		resolved, err := resolver.Resolve(entry)
+		if !errors.Is(err, ErrNotResolved) {
+			return resolved, err
+		}
+	}
+	return nil, ErrNotResolved
+}
+
+// ResolveMode tells how a resolved entry is used.
+type ResolveMode int
+
+const (
+	// ResolveMerge completes the entry, see Entry.Enrich.
+	ResolveMerge ResolveMode = iota
+	// ResolveSubstitute replaces the entry, see Entry.Substitute.
+	ResolveSubstitute
+)
+
+// ResolveModes are the modes by name.
+var ResolveModes = map[string]ResolveMode{
+	"merge":      ResolveMerge,
+	"substitute": ResolveSubstitute,
+}
+
+// Enrich completes the entry with the metadata of resolved, as
+// returned by a Resolver: its type, title, authors, year and
+// fields replace those of the entry, which keeps its key, URL and
+// urldate; the URL is taken only when the entry has none. The
+// fields taken are recorded as coming from resolved.
+func (b *Entry) Enrich(resolved *Entry) {
+	if resolved.Type != emptyString {
+		b.Type = resolved.Type
+	}
+	if resolved.Title != emptyString {
+		b.Title = resolved.Title
+		b.takeFrom("title", resolved)
+	}
+	if len(resolved.Authors) > 0 {
+		b.Authors = resolved.Authors
+		b.takeFrom("author", resolved)
+	}
+	if _, ok := resolved.fieldValue("year"); ok {
+		b.copyYear(resolved)
+		b.takeFrom("year", resolved)
+	}
+	if b.URL == emptyString && resolved.URL != emptyString {
+		b.URL = resolved.URL
+		b.takeFrom("url", resolved)
+	}
+	for field, value := range resolved.Fields {
+		if value == emptyString || field == "year" {
+			continue
+		}
+		if b.Fields == nil {
+			b.Fields = make(map[string]string)
+		}
+		b.Fields[field] = value
+		b.takeFrom(field, resolved)
+	}
+}
+
+// Substitute replaces the entry with resolved, as returned by a
+// Resolver, keeping only its key and where it was read from: the
+// fields are recorded as coming from resolved.
+func (b *Entry) Substitute(resolved *Entry) {
+	b.Type = resolved.Type
+	b.Title = resolved.Title
+	b.Authors = resolved.Authors
+	b.Year = resolved.Year
+	b.URL = resolved.URL
+	b.Visited = resolved.Visited
+	b.Fields = make(map[string]string)
+	for field, value := range resolved.Fields {
+		b.Fields[field] = value
+	}
+	b.Provenance = nil
+	for _, field := range b.FieldNames() {
+		b.takeFrom(field, resolved)
+	}
+}
+
+// resolve completes entry with c.config.Resolver, if any, and
+// returns the entry found. An entry that can't be resolved is left
+// as it is, with a warning when the resolver fails rather than
+// finding nothing.
+func (c *Tex2BibConverter) resolve(entry *Entry) *Entry {
+	if c.config.Resolver == nil {
+		return nil
+	}
+	resolved, err := c.config.Resolver.Resolve(entry)
+	switch {
+	case errors.Is(err, ErrNotResolved):
+		return nil
+	case err != nil:
+		c.warnf("%s can't be resolved: %s", entry.Key, err.Error())
+		return nil
+	}
+	if c.config.ResolveMode == ResolveSubstitute {
+		entry.Substitute(resolved)
+	} else {
+		entry.Enrich(resolved)
+	}
+	return resolved
+}
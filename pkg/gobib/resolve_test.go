@@ -0,0 +1,119 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// resolverFunc is a Resolver calling itself.
+type resolverFunc func(entry *Entry) (*Entry, error)
+
+func (f resolverFunc) Resolve(entry *Entry) (*Entry, error) {
+	return f(entry)
+}
+
+const unresolvedBibliography = `
+\begin{thebibliography}{9}
+\bibitem{wcf} R. Anderson, why cryptosystems fail, \doi{10.1145/175222.175223}
+\bibitem{unknown} Someone Else, Whatever, 2000
+\bibitem{broken} Someone Else, Anything, 2001
+\end{thebibliography}
+`
+
+const expectedResolvedBib = `@article{anderson1993why,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1993",
+	doi = {10.1145/175222.175223},
+	journal = {Communications of the ACM},
+	number = {11},
+	pages = {32--40},
+	volume = {37},
+}
+
+@online{else2000whatever,
+	author = "Someone Else",
+	title = {{Whatever}},
+	year = "2000",
+}
+
+@online{else2001anything,
+	author = "Someone Else",
+	title = {{Anything}},
+	year = "2001",
+}
+
+`
+
+// testResolver knows only the DOI of 'Why Cryptosystems Fail',
+// and fails on 'Anything'.
+var testResolver = resolverFunc(func(entry *Entry) (*Entry, error) {
+	switch {
+	case entry.DOI() == "10.1145/175222.175223":
+		return &Entry{
+			Type:    "article",
+			Authors: []string{"Ross Anderson"},
+			Title:   "Why Cryptosystems Fail",
+			Year:    1993,
+			Fields: map[string]string{
+				"journal": "Communications of the ACM",
+				"volume":  "37",
+				"number":  "11",
+				"pages":   "32--40",
+				"doi":     "10.1145/175222.175223",
+			},
+			Source: Source{File: "https://api.crossref.org/works/10.1145/175222.175223"},
+		}, nil
+	case entry.Title == "Anything":
+		return nil, errors.New("connection refused")
+	}
+	return nil, ErrNotResolved
+})
+
+func TestCompleteResolved(t *testing.T) {
+	var writer, warnings strings.Builder
+	config := &Config{
+		Output:     &writer,
+		Input:      strings.NewReader(unresolvedBibliography),
+		KeyPattern: "{author}{year}{title}",
+		Resolver:   testResolver,
+		Warnings:   &warnings,
+	}
+	runTestComplete(config, expectedResolvedBib, t)
+	gotExpected(warnings.String(), "warning: broken can't be resolved: connection refused\n", false, t)
+}
+
+func TestEnrich(t *testing.T) {
+	entry := NewEntry("wcf", []string{"R. Anderson"}, "why cryptosystems fail", 0, "example.com/wcf.pdf", nil)
+	entry.Source = Source{File: "bib.tex", Line: 3}
+	resolved, _ := testResolver.Resolve(&Entry{Fields: map[string]string{"doi": "10.1145/175222.175223"}})
+	entry.Enrich(resolved)
+
+	if entry.Key != "wcf" || entry.URL != "example.com/wcf.pdf" {
+		t.Errorf("The key or the URL are lost: %s %s", entry.Key, entry.URL)
+	}
+	if entry.Type != "article" || entry.Title != "Why Cryptosystems Fail" || entry.Fields["pages"] != "32--40" {
+		t.Errorf("Wrong enriched entry: %s", entry)
+	}
+	sources := entry.FieldSources()
+	gotExpected(sources["url"].String(), "bib.tex:3", false, t)
+	gotExpected(sources["journal"].String(), resolved.Source.String(), false, t)
+}
@@ -0,0 +1,140 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortOrder is the order the entries are sorted by.
+type SortOrder int
+
+const (
+	// SortNone keeps the entries in their order.
+	SortNone SortOrder = iota
+	// SortKey sorts the entries by key.
+	SortKey
+	// SortAuthor sorts the entries by the surname of the first author.
+	SortAuthor
+	// SortYear sorts the entries by year, the oldest first.
+	SortYear
+	// SortYearDesc sorts the entries by year, the newest first.
+	SortYearDesc
+	// SortTitle sorts the entries by title.
+	SortTitle
+	// SortType sorts the entries by type.
+	SortType
+)
+
+// SortOrders are the orders by name.
+var SortOrders = map[string]SortOrder{
+	"none":      SortNone,
+	"key":       SortKey,
+	"author":    SortAuthor,
+	"year":      SortYear,
+	"year-desc": SortYearDesc,
+	"title":     SortTitle,
+	"type":      SortType,
+}
+
+// SortEntries sorts the entries by order. The sort is stable:
+// the entries having the same value keep their order.
+func SortEntries(entries []*Entry, order SortOrder) {
+	var less func(a, b *Entry) bool
+	switch order {
+	case SortKey:
+		less = func(a, b *Entry) bool {
+			return a.Key < b.Key
+		}
+	case SortAuthor:
+		less = func(a, b *Entry) bool {
+			return a.firstSurname() < b.firstSurname()
+		}
+	case SortYear:
+		less = func(a, b *Entry) bool {
+			return a.FirstYear() < b.FirstYear()
+		}
+	case SortYearDesc:
+		less = func(a, b *Entry) bool {
+			return a.FirstYear() > b.FirstYear()
+		}
+	case SortTitle:
+		less = func(a, b *Entry) bool {
+			return NormalizeTitle(a.Title) < NormalizeTitle(b.Title)
+		}
+	case SortType:
+		less = func(a, b *Entry) bool {
+			return a.entryType() < b.entryType()
+		}
+	default:
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return less(entries[i], entries[j])
+	})
+}
+
+// entryType returns the type of the entry as it's written.
+func (b *Entry) entryType() string {
+	if b.Type == emptyString {
+		return "online"
+	}
+	return strings.ToLower(b.Type)
+}
+
+// groupName returns the name of the group of an entry when the
+// entries are sorted by order: the year, the type, or the first
+// letter of the key, the author or the title.
+func groupName(entry *Entry, order SortOrder) string {
+	var name string
+	switch order {
+	case SortYear, SortYearDesc:
+		if entry.FirstYear() == emptyYear {
+			return "no year"
+		}
+		return strconv.Itoa(entry.FirstYear())
+	case SortType:
+		return entry.entryType()
+	case SortKey:
+		name = entry.Key
+	case SortAuthor:
+		if name = entry.firstSurname(); name == emptyString {
+			return "no author"
+		}
+	case SortTitle:
+		name = NormalizeTitle(entry.Title)
+	}
+	for _, r := range name {
+		return strings.ToUpper(string(r))
+	}
+	return ""
+}
+
+// writeGroups writes the entries with a comment before each
+// group of them, see groupName.
+func (c *Tex2BibConverter) writeGroups(entries []*Entry) {
+	for i, entry := range entries {
+		name := groupName(entry, c.config.Sort)
+		if i == 0 || name != groupName(entries[i-1], c.config.Sort) {
+			c.write("% ---- " + name + " ----\n\n")
+		}
+		c.writeEntry(entry)
+	}
+}
@@ -0,0 +1,96 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+)
+
+func sortedKeys(entries []*Entry, order SortOrder) string {
+	SortEntries(entries, order)
+	var keys []string
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestSortEntries(t *testing.T) {
+	entries := []*Entry{
+		{Key: "c", Authors: []string{"Zed Zulu"}, Year: 2001},
+		{Key: "a", Authors: []string{"Alpha, Al"}, Year: 2010},
+		{Key: "b", Authors: []string{"Zed Zulu"}, Year: 1999},
+		{Key: "d", Year: 2001},
+	}
+	gotExpected(sortedKeys(entries, SortNone), "c,a,b,d", false, t)
+	gotExpected(sortedKeys(entries, SortYear), "b,c,d,a", false, t)
+	gotExpected(sortedKeys(entries, SortAuthor), "d,a,b,c", false, t)
+	gotExpected(sortedKeys(entries, SortKey), "a,b,c,d", false, t)
+}
+
+const expectedGroupedBib = `% ---- 2011 ----
+
+@online{aass,
+	author = "Asking Alexandria",
+	title = {{Someone Somewhere}},
+	year = "2011",
+}
+
+% ---- 1909 ----
+
+@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1909",
+	url = {example.com/ra/wcf.pdf},
+}
+
+% ---- no year ----
+
+@online{wcdf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Don't Fail}},
+}
+
+`
+
+func TestCompleteGrouped(t *testing.T) {
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(bib),
+		Sort:   SortYearDesc,
+		Group:  true,
+	}
+	runTestComplete(config, expectedGroupedBib, t)
+}
+
+func TestGroupName(t *testing.T) {
+	entry := &Entry{Key: "wcf", Authors: []string{"Ross Anderson"}, Title: "{Why} Cryptosystems Fail", Year: 1994}
+	expected := map[SortOrder]string{
+		SortKey:    "W",
+		SortAuthor: "A",
+		SortYear:   "1994",
+		SortTitle:  "W",
+		SortType:   "online",
+	}
+	for order, name := range expected {
+		gotExpected(groupName(entry, order), name, false, t)
+	}
+}
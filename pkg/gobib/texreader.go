@@ -0,0 +1,231 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth is how many \input can be nested.
+const maxIncludeDepth = 16
+
+// verbatimEnvironments are the environments whose content
+// is never looked at.
+var verbatimEnvironments = []string{
+	"verbatim", "verbatim*", "Verbatim", "lstlisting", "minted", "comment",
+}
+
+// includeRegexp matches '\input{file}', '\include{file}' and '\input file'.
+var includeRegexp = regexp.MustCompile(`\\(?:input|include)(?:\s*\{([^}]*)\}|\s+([^\s{}\\]+))`)
+
+// texFile is a file being read by a texReader.
+type texFile struct {
+	reader *bufio.Reader
+	closer io.Closer
+	name   string
+	line   int
+}
+
+// texReader reads a TeX document line by line, like a bufio.Reader
+// does, but it removes comments and verbatim environments, and it
+// follows \input and \include.
+type texReader struct {
+	files []*texFile
+	// dir is where the included files are looked for,
+	// if empty includes are not followed
+	dir string
+	// verbatimEnd is the end of the verbatim environment
+	// we're into, if any
+	verbatimEnd string
+
+	// where the last line was read, and its comment
+	file    string
+	line    int
+	comment string
+
+	// included are the files included so far,
+	// the missing ones too
+	included []string
+}
+
+// newTexReader returns a texReader reading from r. name is
+// the name of the file r reads from, it may be empty.
+func newTexReader(r io.Reader, name string) *texReader {
+	reader := &texReader{
+		files: []*texFile{{reader: bufio.NewReader(r), name: name}},
+	}
+	if name != "" {
+		reader.dir = filepath.Dir(name)
+	}
+	return reader
+}
+
+// position returns the file and the line of the last line read.
+func (t *texReader) position() (string, int) {
+	return t.file, t.line
+}
+
+// lastComment returns the comment of the last line read,
+// without the '%'.
+func (t *texReader) lastComment() string {
+	return t.comment
+}
+
+// ReadLine returns the next line of the document,
+// in the same way bufio.Reader.ReadLine does.
+func (t *texReader) ReadLine() ([]byte, bool, error) {
+	for len(t.files) > 0 {
+		top := t.files[len(t.files)-1]
+		line, isPrefix, err := top.reader.ReadLine()
+		if err == io.EOF {
+			// this file is finished, back to the one including it
+			if top.closer != nil {
+				top.closer.Close()
+			}
+			t.files = t.files[:len(t.files)-1]
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		top.line++
+		t.file, t.line, t.comment = top.name, top.line, ""
+		return []byte(t.clean(string(line))), isPrefix, nil
+	}
+	return nil, false, io.EOF
+}
+
+// clean removes the comments and the verbatim environments from a
+// line, and it starts reading any file included by the line.
+func (t *texReader) clean(line string) string {
+	if t.verbatimEnd != "" {
+		end := strings.Index(line, t.verbatimEnd)
+		if end == -1 {
+			return ""
+		}
+		line = line[end+len(t.verbatimEnd):]
+		t.verbatimEnd = ""
+	}
+
+	line, t.comment = stripComment(line)
+
+	for _, environment := range verbatimEnvironments {
+		begin := strings.Index(line, "\\begin{"+environment+"}")
+		if begin == -1 {
+			continue
+		}
+		end := "\\end{" + environment + "}"
+		if index := strings.Index(line[begin:], end); index != -1 {
+			line = line[:begin] + t.clean(line[begin+index+len(end):])
+		} else {
+			t.verbatimEnd = end
+			line = line[:begin]
+		}
+		break
+	}
+
+	return t.include(line)
+}
+
+// include starts reading the first file included by line, if any.
+// It returns what comes before the include, and what comes after it
+// will be read once the included file is finished.
+func (t *texReader) include(line string) string {
+	match := includeRegexp.FindStringSubmatchIndex(line)
+	if match == nil || t.dir == "" || len(t.files) > maxIncludeDepth {
+		return line
+	}
+
+	var name string
+	if match[2] != -1 {
+		name = line[match[2]:match[3]]
+	} else {
+		name = line[match[4]:match[5]]
+	}
+	name = strings.TrimSpace(name)
+	if filepath.Ext(name) == "" {
+		name += ".tex"
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(t.dir, name)
+	}
+
+	for _, file := range t.files {
+		if file.name == name {
+			// it's including itself
+			return line
+		}
+	}
+	t.included = append(t.included, name)
+
+	file, err := os.Open(name)
+	if err != nil {
+		// a missing file is skipped, like a missing figure
+		// it should not stop the conversion
+		return line[:match[0]] + line[match[1]:]
+	}
+
+	// the rest of the line comes after the included file
+	top := t.files[len(t.files)-1]
+	top.reader = bufio.NewReader(io.MultiReader(strings.NewReader(line[match[1]:]+"\n"), top.reader))
+	top.line--
+	t.files = append(t.files, &texFile{
+		reader: bufio.NewReader(file),
+		closer: file,
+		name:   name,
+	})
+	return line[:match[0]]
+}
+
+// stripComment removes the comment, if any, from a line. It returns
+// the line without the comment, and the comment without the '%'.
+// Escaped '%', and the ones inside \url and \verb, are kept.
+func stripComment(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if strings.HasPrefix(line[i:], "\\url{") {
+				if _, end, ok := braceGroup(line, i+len("\\url")); ok {
+					i = end - 1
+				}
+			} else if strings.HasPrefix(line[i:], "\\verb") && i+len("\\verb") < len(line) {
+				start := i + len("\\verb")
+				if line[start] == '*' {
+					start++
+				}
+				if start < len(line) {
+					if end := strings.IndexByte(line[start+1:], line[start]); end != -1 {
+						i = start + 1 + end
+					}
+				}
+			} else {
+				// skipping the escaped char
+				i++
+			}
+		case '%':
+			return line[:i], line[i+1:]
+		}
+	}
+	return line, ""
+}
@@ -0,0 +1,157 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const mainDocument = `\documentclass{book}
+\usepackage{chapterbib}
+\begin{document}
+\include{chapter1}
+% \bibitem{commented} Nobody, Never Converted
+\begin{verbatim}
+\bibitem{verbatim} Nobody, Never Converted
+\end{verbatim}
+\chapter{Two}
+Some text, 50\% of it. \input chapter2 \cite{wcdf}
+\end{document}
+`
+
+const chapter1 = `\chapter{One}
+\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, \url{example.com/100%25}
+%\bibitem{old} Ross Anderson, Old
+\end{thebibliography}
+`
+
+const chapter2 = `\begin{thebibliography}{9}
+\bibitem[{Anderson(1994)}]{wcdf}
+Ross Anderson.
+\newblock Why Cryptosystems Don't Fail.
+\newblock 1994.
+\end{thebibliography}
+`
+
+const expectedDocumentBib = `@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	url = {example.com/100%25},
+}
+
+% bibliography 2 (DIR/chapter2.tex)
+
+@online{wcdf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Don't Fail}},
+	year = "1994",
+}
+
+`
+
+func TestStripComment(t *testing.T) {
+	tests := map[string]string{
+		"text % comment":          "text ",
+		"50\\% of it":             "50\\% of it",
+		"\\url{a%20b} % x":        "\\url{a%20b} ",
+		"\\verb|%| and % comment": "\\verb|%| and ",
+		"\\\\% comment":           "\\\\",
+	}
+	for line, expected := range tests {
+		got, _ := stripComment(line)
+		gotExpected(got, expected, false, t)
+	}
+}
+
+func TestCutBibitem(t *testing.T) {
+	tests := []struct {
+		line, key, rest string
+	}{
+		{"\\bibitem{key}", "key", ""},
+		{"\\bibitem{key} Foo, {Bar}", "key", " Foo, {Bar}"},
+		{"\\bibitem[{Foo et~al.(2018)}]{key}", "key", ""},
+		{"\\bibitem[Foo(2018)]{key}", "key", ""},
+	}
+	for _, test := range tests {
+		key, rest, ok := cutBibitem(test.line)
+		if !ok {
+			t.Errorf("Fail to cut %s", test.line)
+		}
+		gotExpected(key, test.key, false, t)
+		gotExpected(rest, test.rest, false, t)
+	}
+}
+
+func TestCompleteDocument(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gobib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"main.tex":     mainDocument,
+		"chapter1.tex": chapter1,
+		"chapter2.tex": chapter2,
+	}
+	for name, content := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var writer strings.Builder
+	config := &Config{
+		Output: &writer,
+		Input:  strings.NewReader(mainDocument),
+		Name:   filepath.Join(dir, "main.tex"),
+	}
+	converter := initConverter(config)
+	converter.Converter.Convert()
+	<-converter.Converter.OkChan()
+	gotExpected(writer.String(), strings.Replace(expectedDocumentBib, "DIR", dir, -1), false, t)
+
+	expected := []string{"main.tex", "chapter1.tex", "chapter2.tex"}
+	for i, name := range expected {
+		expected[i] = filepath.Join(dir, name)
+	}
+	gotExpected(strings.Join(converter.Converter.Files(), ","), strings.Join(expected, ","), false, t)
+	if written := converter.Converter.Written(); written != 2 {
+		t.Errorf("Expected 2 entries written, got %d", written)
+	}
+
+	// without goroutines, with a bibliography for each chapter
+	var synchronous strings.Builder
+	config = &Config{
+		Output: &synchronous,
+		Input:  strings.NewReader(mainDocument),
+		Name:   filepath.Join(dir, "main.tex"),
+	}
+	run := NewConverter(config)
+	if err = run.Run(); err != nil {
+		t.Fatal(err)
+	}
+	gotExpected(synchronous.String(), writer.String(), false, t)
+	if entries := run.Entries(); len(entries) != 2 || entries[1].Source.Bibliography != 2 {
+		t.Errorf("Wrong entries written: %v", entries)
+	}
+}
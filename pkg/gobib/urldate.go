@@ -0,0 +1,53 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// accessedRegexp matches a phrase telling when an URL was accessed,
+// like 'Last accessed: 2018-07-06', 'accessed on July 6, 2018' or
+// '[Accessed 6 Jul. 2018]', with the punctuation that may precede it.
+// The date is the first submatch.
+var accessedRegexp = regexp.MustCompile(`(?i)[,.;]?\s*[\[(]?\s*\b(?:last\s+)?(?:accessed|visited)(?:\s+on)?\s*:?\s*` +
+	`([0-9]{4}-[0-9]{1,2}-[0-9]{1,2}|[0-9]{1,2}\s+[a-z]+\.?,?\s+[0-9]{4}|[a-z]+\.?\s+[0-9]{1,2},?\s+[0-9]{4})\s*[\])]?`)
+
+// accessedLayouts are the layouts of the access dates, once the
+// periods and the commas are removed.
+var accessedLayouts = []string{"2006-1-2", "2 January 2006", "2 Jan 2006", "January 2 2006", "Jan 2 2006"}
+
+// cutAccessed removes the phrase telling when the URL was accessed,
+// if any, from a plain TeX bib entry, or from its comments. It
+// returns the entry without the phrase and the date, or nil.
+func cutAccessed(value string) (string, *time.Time) {
+	match := accessedRegexp.FindStringSubmatchIndex(value)
+	if match == nil {
+		return value, nil
+	}
+	date := strings.NewReplacer(".", "", ",", "").Replace(value[match[2]:match[3]])
+	date = strings.Join(strings.Fields(date), " ")
+	for _, layout := range accessedLayouts {
+		if accessed, err := time.Parse(layout, date); err == nil {
+			return strings.TrimSpace(value[:match[0]] + value[match[1]:]), &accessed
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,113 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package gobib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCutAccessed(t *testing.T) {
+	tests := []struct {
+		value, rest, date string
+	}{
+		{"A, Title, \\url{x.org}, Last accessed: 2018-07-06", "A, Title, \\url{x.org}", "2018-07-06"},
+		{"A, Title, \\url{x.org}. Accessed on July 6, 2018.", "A, Title, \\url{x.org}.", "2018-07-06"},
+		{"A, Title, \\url{x.org} [accessed 6 Jul. 2018]", "A, Title, \\url{x.org}", "2018-07-06"},
+		{"A, Title (visited on Sep 30 2019), 2019", "A, Title, 2019", "2019-09-30"},
+		{"accessed 2018-7-6", "", "2018-07-06"},
+		{"A, Title, accessed 6 Foo 2018", "A, Title, accessed 6 Foo 2018", ""},
+		{"A, Title, 2018", "A, Title, 2018", ""},
+	}
+	for _, test := range tests {
+		rest, accessed := cutAccessed(test.value)
+		gotExpected(rest, test.rest, false, t)
+		date := ""
+		if accessed != nil {
+			date = accessed.Format("2006-01-02")
+		}
+		gotExpected(date, test.date, false, t)
+	}
+}
+
+const accessedBibliography = `
+\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, \url{example.com/wcf.pdf}, Last accessed: 2018-07-06
+\bibitem{comment} Ross Anderson, % accessed 2019-01-02
+	Security Engineering, \url{example.com/se.pdf}, accessed on March 3, 2019
+\bibitem{default} Ross Anderson, Programming Satan's Computer, \url{example.com/psc.pdf}
+\bibitem{nourl} Ross Anderson, Why Cryptosystems Don't Fail, accessed on March 3, 2019
+\end{thebibliography}
+`
+
+const expectedAccessedBib = `@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	url = {example.com/wcf.pdf},
+	urldate = "2018-7-6",
+}
+
+@online{comment,
+	author = "Ross Anderson",
+	title = {{Security Engineering}},
+	url = {example.com/se.pdf},
+	urldate = "2019-1-2",
+}
+
+@online{default,
+	author = "Ross Anderson",
+	title = {{Programming Satan's Computer}},
+	url = {example.com/psc.pdf},
+	urldate = "2020-1-1",
+}
+
+@online{nourl,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Don't Fail}},
+}
+
+`
+
+func TestCompleteAccessed(t *testing.T) {
+	var writer strings.Builder
+	defaultTime, _ := time.Parse("2006-01-02", "2020-01-01")
+	config := &Config{
+		Output:         &writer,
+		Input:          strings.NewReader(accessedBibliography),
+		DefaultVisited: &defaultTime,
+	}
+	runTestComplete(config, expectedAccessedBib, t)
+}
+
+func TestListAccessed(t *testing.T) {
+	list := `\section*{References}
+\begin{enumerate}
+\item Ross Anderson, Why Cryptosystems Fail, \url{example.com/wcf.pdf} % accessed 2018-07-06
+\item Ross Anderson, Security Engineering, \url{example.com/se.pdf}
+\end{enumerate}
+`
+	entries, err := ReadEntries(&Config{Input: strings.NewReader(list)})
+	if err != nil {
+		t.Fatalf("Fail to read: %s", err)
+	}
+	if len(entries) != 2 || entries[0].Visited == nil || entries[1].Visited != nil {
+		t.Fatalf("Wrong entries: %v", entries)
+	}
+	gotExpected(entries[0].Visited.Format("2006-01-02"), "2018-07-06", false, t)
+}
@@ -0,0 +1,280 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// bibliographyRegexp matches the bibliographies a LaTeX document
+// uses, like \bibliography{refs} or \addbibresource{refs.bib}.
+var bibliographyRegexp = regexp.MustCompile(`\\(?:bibliography|addbibresource)\s*(?:\[[^\]]*\]\s*)?\{([^}]*)\}`)
+
+// document is an open document, with its entries.
+type document struct {
+	uri   string
+	path  string
+	text  string
+	lines []string
+	// bibtex is true for a .bib file, false for a LaTeX one
+	bibtex bool
+
+	entries []*gobib.Entry
+	// extents are the first and last lines of each entry,
+	// counted from 0
+	extents     [][2]int
+	diagnostics []diagnostic
+}
+
+// uriPath returns the path of a file:// URI, or the URI itself
+// if it isn't one.
+func uriPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+
+// newDocument returns a document, with its entries read using
+// base as the conversion config.
+func newDocument(uri, languageID, text string, base *gobib.Config) *document {
+	d := &document{
+		uri:    uri,
+		path:   uriPath(uri),
+		text:   text,
+		lines:  strings.Split(text, "\n"),
+		bibtex: languageID == "bibtex" || strings.EqualFold(filepath.Ext(uri), ".bib"),
+	}
+	if d.bibtex {
+		d.readBibTeX()
+	} else {
+		d.readTeX(base)
+	}
+	d.setExtents()
+
+	for i, entry := range d.entries {
+		for _, problem := range gobib.Validate(entry) {
+			d.diagnostics = append(d.diagnostics, d.lint(problem, d.extents[i]))
+		}
+	}
+	return d
+}
+
+// readBibTeX reads the entries of a .bib file.
+func (d *document) readBibTeX() {
+	var err error
+	d.entries, err = gobib.ParseBibTeX(strings.NewReader(d.text), d.path)
+
+	var syntaxError *gobib.SyntaxError
+	if errors.As(err, &syntaxError) {
+		d.diagnostics = append(d.diagnostics, d.lineDiagnostic(syntaxError.Line-1, severityError, "syntax", syntaxError.Msg))
+	} else if err != nil {
+		d.diagnostics = append(d.diagnostics, d.lineDiagnostic(0, severityError, "syntax", err.Error()))
+	}
+}
+
+// readTeX reads the \bibitem of a LaTeX document. The entries of
+// the files it includes are left to them.
+func (d *document) readTeX(base *gobib.Config) {
+	config := *base
+	config.Input = strings.NewReader(d.text)
+	config.Name = d.path
+	config.Warnings = nil
+
+	entries, err := gobib.ReadEntries(&config)
+	for _, entry := range entries {
+		if entry.Source.File == d.path {
+			d.entries = append(d.entries, entry)
+		}
+	}
+
+	switch {
+	case errors.Is(err, gobib.ErrBibEmpty):
+		// not every document has a bibliography
+	case errors.Is(err, gobib.ErrBibUnclosed):
+		d.diagnostics = append(d.diagnostics, d.lineDiagnostic(len(d.lines)-1, severityError, "syntax", err.Error()))
+	case err != nil:
+		line := 0
+		if len(d.entries) > 0 {
+			line = d.entries[len(d.entries)-1].Source.Line - 1
+		}
+		d.diagnostics = append(d.diagnostics, d.lineDiagnostic(line, severityError, "syntax", err.Error()))
+	}
+}
+
+// setExtents sets the lines of each entry: from its first line
+// to the line before the next entry, or before the end of the
+// environment, without the trailing blank lines.
+func (d *document) setExtents() {
+	d.extents = make([][2]int, len(d.entries))
+	for i, entry := range d.entries {
+		start := entry.Source.Line - 1
+		if start < 0 || start >= len(d.lines) {
+			start = 0
+		}
+		end := len(d.lines) - 1
+		if i+1 < len(d.entries) && d.entries[i+1].Source.Line-2 < end {
+			end = d.entries[i+1].Source.Line - 2
+		}
+		if !d.bibtex {
+			for line := start + 1; line <= end; line++ {
+				if strings.Contains(d.lines[line], `\end{`) {
+					end = line - 1
+					break
+				}
+			}
+		}
+		for end > start && strings.TrimSpace(d.lines[end]) == "" {
+			end--
+		}
+		d.extents[i] = [2]int{start, end}
+	}
+}
+
+// entryAt returns the index of the entry at a line, or -1.
+func (d *document) entryAt(line int) int {
+	for i, extent := range d.extents {
+		if line >= extent[0] && line <= extent[1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// lineDiagnostic returns a diagnostic spanning a whole line.
+func (d *document) lineDiagnostic(line, severity int, code, message string) diagnostic {
+	if line < 0 || line >= len(d.lines) {
+		line = 0
+	}
+	return diagnostic{
+		Range:    d.lineRange(line),
+		Severity: severity,
+		Code:     code,
+		Source:   "gobib",
+		Message:  message,
+	}
+}
+
+// lineRange returns the range of a whole line.
+func (d *document) lineRange(line int) textRange {
+	return textRange{
+		Start: position{Line: line},
+		End:   position{Line: line, Character: utf16Len(d.lines[line])},
+	}
+}
+
+// lintSeverities maps the severities of the linter to LSP ones.
+var lintSeverities = map[gobib.Severity]int{
+	gobib.SeverityError:   severityError,
+	gobib.SeverityWarning: severityWarning,
+	gobib.SeverityInfo:    severityInformation,
+}
+
+// lint returns a problem found by the linter as a diagnostic, on
+// the line of the field it's about, if it can be found, or on the
+// first line of the entry.
+func (d *document) lint(problem gobib.Diagnostic, extent [2]int) diagnostic {
+	line := extent[0]
+	if problem.Field != "" && d.bibtex {
+		field := regexp.MustCompile(`(?i)^\s*` + regexp.QuoteMeta(problem.Field) + `\s*=`)
+		for i := extent[0]; i <= extent[1]; i++ {
+			if field.MatchString(d.lines[i]) {
+				line = i
+				break
+			}
+		}
+	}
+	return d.lineDiagnostic(line, lintSeverities[problem.Severity], problem.Rule, problem.Message)
+}
+
+// hoverText returns the fields of an entry as Markdown.
+func hoverText(entry *gobib.Entry) string {
+	entryType := entry.Type
+	if entryType == "" {
+		entryType = "online"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**@%s** `%s`\n\n", entryType, entry.Key)
+	values := entry.FieldValues()
+	for _, field := range entry.FieldNames() {
+		fmt.Fprintf(&b, "- **%s**: %s\n", field, values[field])
+	}
+	return b.String()
+}
+
+// bibliographies returns the paths of the .bib files used by a
+// LaTeX document.
+func (d *document) bibliographies() []string {
+	var paths []string
+	for _, match := range bibliographyRegexp.FindAllStringSubmatch(d.text, -1) {
+		for _, name := range strings.Split(match[1], ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if filepath.Ext(name) == "" {
+				name += ".bib"
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(d.path), name)
+			}
+			paths = append(paths, name)
+		}
+	}
+	return paths
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeUnits(r)
+	}
+	return n
+}
+
+// runeUnits returns how many UTF-16 code units encode r.
+func runeUnits(r rune) int {
+	if r >= 0x10000 {
+		// a surrogate pair
+		return 2
+	}
+	return 1
+}
+
+// byteOffset returns the offset in bytes of a character of a
+// line, counted in UTF-16 code units.
+func byteOffset(line string, character int) int {
+	units := 0
+	for offset, r := range line {
+		if units >= character {
+			return offset
+		}
+		units += runeUnits(r)
+	}
+	return len(line)
+}
@@ -0,0 +1,50 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lsp
+
+import (
+	"testing"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+func TestPositions(t *testing.T) {
+	// é is 2 bytes and 1 unit, 𝄞 is 4 bytes and 2 units
+	line := "é𝄞x"
+	if got := utf16Len(line); got != 4 {
+		t.Errorf("Got length %d, expected 4", got)
+	}
+	for character, expected := range map[int]int{0: 0, 1: 2, 3: 6, 4: 7, 10: 7} {
+		if got := byteOffset(line, character); got != expected {
+			t.Errorf("Character %d: got offset %d, expected %d", character, got, expected)
+		}
+	}
+}
+
+func TestExtents(t *testing.T) {
+	d := newDocument("file:///paper.tex", "latex", paper, &gobib.Config{})
+	if len(d.extents) != 2 || d.extents[0] != [2]int{4, 4} || d.extents[1] != [2]int{6, 7} {
+		t.Errorf("Wrong extents: %v", d.extents)
+	}
+	if d.entryAt(5) != -1 || d.entryAt(7) != 1 {
+		t.Errorf("Wrong entries at lines 5 and 7: %d, %d", d.entryAt(5), d.entryAt(7))
+	}
+	if got := uriPath("file:///home/me/a%20b.bib"); got != "/home/me/a b.bib" {
+		t.Errorf("Wrong path: %s", got)
+	}
+}
@@ -0,0 +1,374 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package lsp is a Language Server Protocol server for BibTeX
+// files and the bibliographies of LaTeX documents.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// ErrNoShutdown is returned by Run when the client exits without
+// asking the server to shut down first.
+var ErrNoShutdown = errors.New("exit without shutdown")
+
+// errHeader is returned when a message has a wrong header.
+var errHeader = errors.New("wrong message header")
+
+// citeRegexp matches an unterminated citation command, ending with
+// the keys typed so far, like '\citep[p.~2]{wcf, aa'.
+var citeRegexp = regexp.MustCompile(`\\[A-Za-z]*cite[A-Za-z]*\*?\s*(?:\[[^\]]*\]\s*)*\{([^}]*)$`)
+
+// Config is the configuration of a Server.
+type Config struct {
+	// where the client messages are read from
+	Input io.Reader
+	// where the server messages are written to
+	Output io.Writer
+	// Base is the conversion config used to read the \bibitem,
+	// its Input, Output, Name and Warnings aren't used.
+	Base gobib.Config
+}
+
+// Server is the language server. It publishes the problems found
+// by the parser and the linter in the open documents, shows the
+// fields of the entry under the cursor, completes the keys in the
+// \cite commands and converts a \bibitem to BibTeX.
+type Server struct {
+	config    *Config
+	reader    *bufio.Reader
+	documents map[string]*document
+	shutdown  bool
+	// writeMutex serializes the messages
+	writeMutex sync.Mutex
+}
+
+// New returns a new Server.
+func New(config *Config) *Server {
+	return &Server{
+		config:    config,
+		reader:    bufio.NewReader(config.Input),
+		documents: make(map[string]*document),
+	}
+}
+
+// Run serves the client till it exits. It returns nil if it asked
+// the server to shut down first, or if the input is finished.
+func (s *Server) Run() error {
+	for {
+		content, err := readMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err = json.Unmarshal(content, &req); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+		s.handle(&req)
+	}
+}
+
+// readMessage reads the content of a message, which is preceded
+// by its 'Content-Length' header.
+func readMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line != "" {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("%w: %s", errHeader, line)
+		}
+		if strings.EqualFold(strings.TrimSpace(line[:colon]), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[colon+1:])); err != nil {
+				return nil, fmt.Errorf("%w: %s", errHeader, line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("%w: no Content-Length", errHeader)
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(reader, content)
+	return content, err
+}
+
+// write writes a message.
+func (s *Server) write(v interface{}) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gobib lsp: %s\n", err.Error())
+		return
+	}
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	fmt.Fprintf(s.config.Output, "Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}) {
+	s.write(&response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id json.RawMessage, code int, message string) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	s.write(&errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle handles a request, or a notification when it has no ID.
+func (s *Server) handle(req *request) {
+	isNotification := len(req.ID) == 0 || string(req.ID) == "null"
+	if s.shutdown && !isNotification {
+		s.replyError(req.ID, codeInvalidRequest, "the server is shut down")
+		return
+	}
+
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "initialize":
+		result = initialize()
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			item := params.TextDocument
+			s.open(newDocument(item.URI, item.LanguageID, item.Text, &s.config.Base))
+		}
+	case "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			if old, ok := s.documents[params.TextDocument.URI]; ok {
+				text := params.ContentChanges[len(params.ContentChanges)-1].Text
+				languageID := "latex"
+				if old.bibtex {
+					languageID = "bibtex"
+				}
+				s.open(newDocument(old.uri, languageID, text, &s.config.Base))
+			}
+		}
+	case "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []diagnostic{},
+			})
+		}
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.hover(&params)
+		}
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.complete(&params)
+		}
+	case "textDocument/codeAction":
+		var params codeActionParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.codeActions(&params)
+		}
+	default:
+		if !isNotification {
+			s.replyError(req.ID, codeMethodNotFound, "unknown method "+req.Method)
+		}
+		return
+	}
+
+	switch {
+	case isNotification:
+	case err != nil:
+		s.replyError(req.ID, codeInvalidParams, err.Error())
+	default:
+		s.reply(req.ID, result)
+	}
+}
+
+// initialize returns what the server can do.
+func initialize() *initializeResult {
+	result := &initializeResult{}
+	result.Capabilities.TextDocumentSync = textDocumentSyncFull
+	result.Capabilities.HoverProvider = true
+	result.Capabilities.CodeActionProvider = true
+	result.Capabilities.CompletionProvider.TriggerCharacters = []string{"{", ","}
+	result.ServerInfo.Name = "gobib"
+	return result
+}
+
+// open sets the document, publishing its diagnostics.
+func (s *Server) open(d *document) {
+	s.documents[d.uri] = d
+	diagnostics := d.diagnostics
+	if diagnostics == nil {
+		diagnostics = []diagnostic{}
+	}
+	s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{URI: d.uri, Diagnostics: diagnostics})
+}
+
+// hover returns the fields of the entry at the position, or nil.
+func (s *Server) hover(params *textDocumentPositionParams) *hover {
+	d, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	i := d.entryAt(params.Position.Line)
+	if i < 0 {
+		return nil
+	}
+	entryRange := textRange{
+		Start: position{Line: d.extents[i][0]},
+		End:   d.lineRange(d.extents[i][1]).End,
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: hoverText(d.entries[i])},
+		Range:    &entryRange,
+	}
+}
+
+// complete returns the keys that can be cited at the position, if
+// it's inside the braces of a citation command: those of the open
+// documents and of the .bib files the document uses.
+func (s *Server) complete(params *textDocumentPositionParams) *completionList {
+	list := &completionList{Items: []completionItem{}}
+	d, ok := s.documents[params.TextDocument.URI]
+	if !ok || d.bibtex || params.Position.Line >= len(d.lines) {
+		return list
+	}
+	line := d.lines[params.Position.Line]
+	match := citeRegexp.FindStringSubmatch(line[:byteOffset(line, params.Position.Character)])
+	if match == nil {
+		return list
+	}
+	keys := strings.Split(match[1], ",")
+	prefix := strings.TrimSpace(keys[len(keys)-1])
+
+	var entries []*gobib.Entry
+	for _, open := range s.documents {
+		entries = append(entries, open.entries...)
+	}
+	for _, path := range d.bibliographies() {
+		if s.isOpen(path) {
+			// its entries are already there
+			continue
+		}
+		if file, err := os.Open(path); err == nil {
+			read, _ := gobib.ParseBibTeX(file, path)
+			file.Close()
+			entries = append(entries, read...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.Key] || !strings.HasPrefix(entry.Key, prefix) {
+			continue
+		}
+		seen[entry.Key] = true
+		item := completionItem{Label: entry.Key, Kind: completionItemKindReference, Detail: entry.Title}
+		if entry.Year != 0 {
+			item.Documentation = fmt.Sprintf("%s (%d)", entry.AuthorsToString(), entry.Year)
+		} else {
+			item.Documentation = entry.AuthorsToString()
+		}
+		list.Items = append(list.Items, item)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Label < list.Items[j].Label
+	})
+	return list
+}
+
+// isOpen returns whether the document of a path is open.
+func (s *Server) isOpen(path string) bool {
+	for _, d := range s.documents {
+		if d.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// codeActions returns the action converting the \bibitem at the
+// start of the range to BibTeX, replacing it.
+func (s *Server) codeActions(params *codeActionParams) []codeAction {
+	actions := []codeAction{}
+	d, ok := s.documents[params.TextDocument.URI]
+	if !ok || d.bibtex {
+		return actions
+	}
+	i := d.entryAt(params.Range.Start.Line)
+	if i < 0 {
+		return actions
+	}
+
+	edit := textEdit{
+		Range: textRange{
+			Start: position{Line: d.extents[i][0]},
+			End:   d.lineRange(d.extents[i][1]).End,
+		},
+		NewText: d.entries[i].String(),
+	}
+	return append(actions, codeAction{
+		Title: "Convert this \\bibitem to BibTeX",
+		Kind:  "refactor.rewrite",
+		Edit:  &workspaceEdit{Changes: map[string][]textEdit{d.uri: {edit}}},
+	})
+}
@@ -0,0 +1,245 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const paper = `\documentclass{article}
+\begin{document}
+As shown in \cite{wcf, a
+\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, \url{https://example.com/wcf}, 1994
+
+\bibitem{aass}
+Asking Alexandria, Someone Somewhere
+\end{thebibliography}
+\bibliography{refs}
+\end{document}
+`
+
+const refs = `@article{anderson1994,
+  author = {Ross Anderson},
+  title = {Why Cryptosystems Fail},
+  journal = {Communications of the ACM},
+  year = 3000,
+}
+`
+
+// client is a scripted LSP client.
+type client struct {
+	t      *testing.T
+	input  *io.PipeWriter
+	output *bufio.Reader
+	done   chan error
+	id     int
+}
+
+func newClient(t *testing.T) *client {
+	serverInput, input := io.Pipe()
+	output, serverOutput := io.Pipe()
+	c := &client{t: t, input: input, output: bufio.NewReader(output), done: make(chan error, 1)}
+	server := New(&Config{Input: serverInput, Output: serverOutput})
+	go func() {
+		c.done <- server.Run()
+		serverOutput.Close()
+	}()
+	return c
+}
+
+func (c *client) send(message interface{}) {
+	c.t.Helper()
+	content, err := json.Marshal(message)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fmt.Fprintf(c.input, "Content-Length: %d\r\n\r\n%s", len(content), content)
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// receive reads a message into v.
+func (c *client) receive(v interface{}) {
+	c.t.Helper()
+	content, err := readMessage(c.output)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err = json.Unmarshal(content, v); err != nil {
+		c.t.Fatalf("Wrong message %s: %s", content, err)
+	}
+}
+
+// call sends a request and reads its result into result, returning
+// the error, if any.
+func (c *client) call(method string, params, result interface{}) *responseError {
+	c.t.Helper()
+	c.id++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+
+	var response struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *responseError  `json:"error"`
+	}
+	c.receive(&response)
+	if response.ID != c.id {
+		c.t.Fatalf("Got the response to %d, expected %d", response.ID, c.id)
+	}
+	if response.Error == nil && result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return response.Error
+}
+
+// diagnostics reads the diagnostics published for a document.
+func (c *client) diagnostics(uri string) []diagnostic {
+	c.t.Helper()
+	var message struct {
+		Method string                   `json:"method"`
+		Params publishDiagnosticsParams `json:"params"`
+	}
+	c.receive(&message)
+	if message.Method != "textDocument/publishDiagnostics" || message.Params.URI != uri {
+		c.t.Fatalf("Unexpected message %+v", message)
+	}
+	return message.Params.Diagnostics
+}
+
+func (c *client) open(uri, languageID, text string) []diagnostic {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": textDocumentItem{URI: uri, LanguageID: languageID, Version: 1, Text: text},
+	})
+	return c.diagnostics(uri)
+}
+
+func codes(diagnostics []diagnostic) string {
+	var result []string
+	for _, d := range diagnostics {
+		result = append(result, fmt.Sprintf("%d:%s", d.Range.Start.Line, d.Code))
+	}
+	return strings.Join(result, " ")
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "refs.bib"), []byte(refs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	paperURI := "file://" + filepath.ToSlash(filepath.Join(dir, "paper.tex"))
+
+	c := newClient(t)
+	var initialized initializeResult
+	if err := c.call("initialize", map[string]interface{}{"capabilities": struct{}{}}, &initialized); err != nil {
+		t.Fatal(err.Message)
+	}
+	if !initialized.Capabilities.HoverProvider || initialized.Capabilities.TextDocumentSync != textDocumentSyncFull {
+		t.Errorf("Wrong capabilities: %+v", initialized)
+	}
+	c.notify("initialized", struct{}{})
+
+	// aass has neither year nor url
+	diagnostics := c.open(paperURI, "latex", paper)
+	if got := codes(diagnostics); got != "6:required-field 6:required-field" {
+		t.Errorf("Wrong diagnostics: %s", got)
+	}
+
+	var hovered hover
+	c.call("textDocument/hover", textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: paperURI}, Position: position{Line: 7, Character: 3}}, &hovered)
+	if !strings.Contains(hovered.Contents.Value, "`aass`") || !strings.Contains(hovered.Contents.Value, "**author**: Asking Alexandria") {
+		t.Errorf("Wrong hover: %s", hovered.Contents.Value)
+	}
+	if hovered.Range == nil || hovered.Range.Start.Line != 6 || hovered.Range.End.Line != 7 {
+		t.Errorf("Wrong hover range: %+v", hovered.Range)
+	}
+
+	var completions completionList
+	c.call("textDocument/completion", textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: paperURI}, Position: position{Line: 2, Character: 24}}, &completions)
+	var labels []string
+	for _, item := range completions.Items {
+		labels = append(labels, item.Label)
+	}
+	if got := strings.Join(labels, ","); got != "aass,anderson1994" {
+		t.Errorf("Wrong completions: %s", got)
+	}
+	// not inside a \cite
+	c.call("textDocument/completion", textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: paperURI}, Position: position{Line: 2, Character: 5}}, &completions)
+	if len(completions.Items) != 0 {
+		t.Errorf("Unexpected completions: %+v", completions.Items)
+	}
+
+	var actions []codeAction
+	c.call("textDocument/codeAction", codeActionParams{TextDocument: textDocumentIdentifier{URI: paperURI}, Range: textRange{Start: position{Line: 4}, End: position{Line: 4}}}, &actions)
+	if len(actions) != 1 {
+		t.Fatalf("Wrong actions: %+v", actions)
+	}
+	edit := actions[0].Edit.Changes[paperURI][0]
+	if edit.Range.Start.Line != 4 || edit.Range.End.Line != 4 || !strings.HasPrefix(edit.NewText, "@online{wcf,\n") {
+		t.Errorf("Wrong edit: %+v", edit)
+	}
+
+	// the field of the problem is pointed at
+	refsURI := "file://" + filepath.ToSlash(filepath.Join(dir, "refs.bib"))
+	if got := codes(c.open(refsURI, "bibtex", refs)); got != "4:suspicious-year" {
+		t.Errorf("Wrong diagnostics: %s", got)
+	}
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   textDocumentIdentifier{URI: refsURI},
+		"contentChanges": []map[string]string{{"text": "@article{broken,\n  title = {Why\n"}},
+	})
+	if got := codes(c.diagnostics(refsURI)); got != "1:syntax" {
+		t.Errorf("Wrong diagnostics: %s", got)
+	}
+	c.notify("textDocument/didClose", map[string]interface{}{"textDocument": textDocumentIdentifier{URI: refsURI}})
+	if len(c.diagnostics(refsURI)) != 0 {
+		t.Error("The diagnostics of a closed document are not cleared")
+	}
+
+	if err := c.call("textDocument/rename", struct{}{}, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("Wrong error: %+v", err)
+	}
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Fatal(err.Message)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrNoShutdown {
+		t.Errorf("Expected ErrNoShutdown, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package resolve
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// Cache is a gobib.Resolver remembering, in a JSON file, what
+// another resolver finds, so that each entry is resolved once.
+// The entries are looked up by DOI, or by title and year when
+// they have none. That nothing was found is remembered as well,
+// while the errors aren't. It can be used by several goroutines.
+type Cache struct {
+	resolver gobib.Resolver
+	path     string
+
+	mutex   sync.Mutex
+	records map[string]*record
+	changed bool
+}
+
+// record is a resolved entry, as it's cached. A nil
+// record means that nothing was found.
+type record struct {
+	Type    string            `json:"type,omitempty"`
+	Title   string            `json:"title,omitempty"`
+	Authors []string          `json:"authors,omitempty"`
+	Year    int               `json:"year,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Source  string            `json:"source,omitempty"`
+}
+
+// OpenCache returns the cache of resolver kept in the file at
+// path, which doesn't need to exist: it's written by Save.
+func OpenCache(path string, resolver gobib.Resolver) (*Cache, error) {
+	cache := &Cache{
+		resolver: resolver,
+		path:     path,
+		records:  make(map[string]*record),
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &cache.records); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// cacheKey returns the key an entry is cached by, or an empty
+// string if the entry has neither a DOI nor a title.
+func cacheKey(entry *gobib.Entry) string {
+	if doi := entry.DOI(); doi != "" {
+		return "doi:" + doi
+	}
+	if title := gobib.NormalizeTitle(entry.Title); title != "" {
+		return "title:" + title + ":" + strconv.Itoa(entry.FirstYear())
+	}
+	return ""
+}
+
+// Resolve returns the cached entry, asking the resolver
+// for it the first time.
+func (c *Cache) Resolve(entry *gobib.Entry) (*gobib.Entry, error) {
+	key := cacheKey(entry)
+	if key == "" {
+		return c.resolver.Resolve(entry)
+	}
+
+	c.mutex.Lock()
+	cached, ok := c.records[key]
+	c.mutex.Unlock()
+	if ok {
+		if cached == nil {
+			return nil, gobib.ErrNotResolved
+		}
+		return cached.entry(), nil
+	}
+
+	// the lock isn't held while resolving, the same entry may
+	// then be resolved twice, which is harmless
+	resolved, err := c.resolver.Resolve(entry)
+	if err != nil && !errors.Is(err, gobib.ErrNotResolved) {
+		return nil, err
+	}
+	var found *record
+	if resolved != nil {
+		found = newRecord(resolved)
+	}
+	c.mutex.Lock()
+	c.records[key] = found
+	c.changed = true
+	c.mutex.Unlock()
+	if found == nil {
+		return nil, gobib.ErrNotResolved
+	}
+	return found.entry(), nil
+}
+
+// Save writes the cache to its file, if anything changed,
+// creating its directory if needed.
+func (c *Cache) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.changed {
+		return nil
+	}
+	content, err := json.MarshalIndent(c.records, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	// replaced at once, so that it's never seen half written
+	temp := c.path + ".tmp"
+	if err = os.WriteFile(temp, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(temp, c.path); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+// newRecord returns the record of a resolved entry.
+func newRecord(entry *gobib.Entry) *record {
+	return &record{
+		Type:    entry.Type,
+		Title:   entry.Title,
+		Authors: entry.Authors,
+		Year:    entry.Year,
+		Fields:  entry.Fields,
+		Source:  entry.Source.File,
+	}
+}
+
+// entry returns a new entry from the record, which
+// doesn't share anything with it.
+func (r *record) entry() *gobib.Entry {
+	entry := &gobib.Entry{
+		Type:    r.Type,
+		Title:   r.Title,
+		Authors: append([]string(nil), r.Authors...),
+		Year:    r.Year,
+		Fields:  make(map[string]string),
+		Source:  gobib.Source{File: r.Source},
+	}
+	for field, value := range r.Fields {
+		entry.Fields[field] = value
+	}
+	return entry
+}
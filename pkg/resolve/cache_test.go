@@ -0,0 +1,131 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package resolve
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// countingResolver counts the calls, resolving only
+// the entries titled 'Known'.
+type countingResolver struct {
+	calls int
+	err   error
+}
+
+func (r *countingResolver) Resolve(entry *gobib.Entry) (*gobib.Entry, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	if entry.Title != "Known" {
+		return nil, gobib.ErrNotResolved
+	}
+	return &gobib.Entry{
+		Type:    "article",
+		Title:   "Known",
+		Authors: []string{"Ross Anderson"},
+		Year:    1993,
+		Fields:  map[string]string{"journal": "Journal"},
+		Source:  gobib.Source{File: "stub"},
+	}, nil
+}
+
+func TestCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "crossref.json")
+	resolver := &countingResolver{}
+	cache, err := OpenCache(path, resolver)
+	if err != nil {
+		t.Fatalf("Fail to open: %s", err)
+	}
+
+	known := gobib.NewEntry("k", nil, "Known", 0, "", nil)
+	unknown := gobib.NewEntry("u", nil, "Unknown", 0, "", nil)
+	for i := 0; i < 2; i++ {
+		resolved, err := cache.Resolve(known)
+		if err != nil || resolved.Fields["journal"] != "Journal" || resolved.Source.File != "stub" {
+			t.Errorf("Wrong entry: %v %v", resolved, err)
+		}
+		// changing the result doesn't change the cache
+		resolved.Fields["journal"] = "Changed"
+		if _, err = cache.Resolve(unknown); !errors.Is(err, gobib.ErrNotResolved) {
+			t.Errorf("Wrong error: %v", err)
+		}
+	}
+	if resolver.calls != 2 {
+		t.Errorf("Wrong calls: %d", resolver.calls)
+	}
+	if err = cache.Save(); err != nil {
+		t.Fatalf("Fail to save: %s", err)
+	}
+
+	// a new cache reads the file
+	resolver = &countingResolver{err: errors.New("offline")}
+	if cache, err = OpenCache(path, resolver); err != nil {
+		t.Fatalf("Fail to open again: %s", err)
+	}
+	if resolved, err := cache.Resolve(known); err != nil || resolved.Title != "Known" || resolved.Year != 1993 {
+		t.Errorf("Wrong entry: %v %v", resolved, err)
+	}
+	if _, err = cache.Resolve(unknown); !errors.Is(err, gobib.ErrNotResolved) {
+		t.Errorf("Wrong error: %v", err)
+	}
+	// the errors aren't cached
+	other := gobib.NewEntry("o", nil, "Other", 0, "", nil)
+	for i := 0; i < 2; i++ {
+		if _, err = cache.Resolve(other); err == nil || errors.Is(err, gobib.ErrNotResolved) {
+			t.Errorf("Wrong error: %v", err)
+		}
+	}
+	if resolver.calls != 2 {
+		t.Errorf("Wrong calls: %d", resolver.calls)
+	}
+}
+
+func TestOpenCacheError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crossref.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCache(path, &countingResolver{}); err == nil {
+		t.Errorf("A broken cache is opened")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	tests := []struct {
+		entry *gobib.Entry
+		key   string
+	}{
+		{&gobib.Entry{Title: "Known", Fields: map[string]string{"doi": "10.1145/1"}}, "doi:10.1145/1"},
+		{&gobib.Entry{Title: "Known", Year: 2018}, "title:known:2018"},
+		{&gobib.Entry{Title: "Known", Fields: map[string]string{"date": "2018-06"}}, "title:known:2018"},
+		{&gobib.Entry{Title: "Known", Fields: map[string]string{"year": "2017--2018"}}, "title:known:2017"},
+		{&gobib.Entry{}, ""},
+	}
+	for _, test := range tests {
+		if key := cacheKey(test.entry); key != test.key {
+			t.Errorf("Expected %q, got %q", test.key, key)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package resolve has the gobib resolvers, which complete the
+// entries with authoritative metadata: a client of the Crossref
+// API, and a cache remembering what a resolver found.
+package resolve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// DefaultCrossrefURL is the URL of the Crossref REST API.
+const DefaultCrossrefURL = "https://api.crossref.org"
+
+// searchRows is how many works are asked for when searching
+// by title, the first one matching the entry is taken.
+const searchRows = 5
+
+// maxResponseSize is the largest response read from the API.
+const maxResponseSize = 4 << 20
+
+// Crossref is a gobib.Resolver asking the Crossref REST API, or
+// any API compatible with it, for the works: by DOI when the entry
+// has one, by title and first author otherwise. A work found by
+// title is taken only when it's a duplicate of the entry, see
+// gobib.IsDuplicate.
+type Crossref struct {
+	// BaseURL is the URL of the API, DefaultCrossrefURL if empty.
+	BaseURL string
+	// Mailto, if not empty, is the e-mail address sent along the
+	// requests, as the Crossref etiquette asks.
+	Mailto string
+	// Client is the HTTP client, one with a 10 seconds
+	// timeout if nil.
+	Client *http.Client
+}
+
+// defaultClient is the client used when Crossref.Client is nil.
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// work is a Crossref work, as returned by the API.
+type work struct {
+	DOI            string   `json:"DOI"`
+	Type           string   `json:"type"`
+	Title          []string `json:"title"`
+	ContainerTitle []string `json:"container-title"`
+	Author         []struct {
+		Given  string `json:"given"`
+		Family string `json:"family"`
+		Name   string `json:"name"`
+	} `json:"author"`
+	Issued struct {
+		DateParts [][]int `json:"date-parts"`
+	} `json:"issued"`
+	Volume    string `json:"volume"`
+	Issue     string `json:"issue"`
+	Page      string `json:"page"`
+	Publisher string `json:"publisher"`
+}
+
+// workTypes maps the Crossref types to the BibTeX ones,
+// the others are 'misc'.
+var workTypes = map[string]string{
+	"journal-article":     "article",
+	"proceedings-article": "inproceedings",
+	"book":                "book",
+	"monograph":           "book",
+	"edited-book":         "book",
+	"book-chapter":        "incollection",
+	"report":              "techreport",
+	"dissertation":        "phdthesis",
+	"posted-content":      "online",
+}
+
+// markupRegexp matches the JATS or HTML tags, like '<i>',
+// that Crossref titles may have.
+var markupRegexp = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9:.-]*[^<>]*>`)
+
+// Resolve returns the Crossref work of the entry.
+func (c *Crossref) Resolve(entry *gobib.Entry) (*gobib.Entry, error) {
+	if doi := entry.DOI(); doi != "" {
+		var response struct {
+			Message work `json:"message"`
+		}
+		if err := c.get("/works/"+url.PathEscape(doi), nil, &response); err != nil {
+			return nil, err
+		}
+		return c.entry(&response.Message), nil
+	}
+
+	if entry.Title == "" {
+		return nil, gobib.ErrNotResolved
+	}
+	query := url.Values{
+		"query.bibliographic": {entry.Title},
+		"rows":                {strconv.Itoa(searchRows)},
+	}
+	if len(entry.Authors) > 0 {
+		query.Set("query.author", gobib.Surname(entry.Authors[0]))
+	}
+	var response struct {
+		Message struct {
+			Items []work `json:"items"`
+		} `json:"message"`
+	}
+	if err := c.get("/works", query, &response); err != nil {
+		return nil, err
+	}
+	for i := range response.Message.Items {
+		found := c.entry(&response.Message.Items[i])
+		if ok, _ := gobib.IsDuplicate(entry, found); ok {
+			return found, nil
+		}
+	}
+	return nil, gobib.ErrNotResolved
+}
+
+// base returns the URL of the API, without the trailing slash.
+func (c *Crossref) base() string {
+	if c.BaseURL == "" {
+		return DefaultCrossrefURL
+	}
+	return strings.TrimRight(c.BaseURL, "/")
+}
+
+// get asks the API for path, decoding the response into v.
+// A work that doesn't exist is ErrNotResolved.
+func (c *Crossref) get(path string, query url.Values, v interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.Mailto != "" {
+		query.Set("mailto", c.Mailto)
+	}
+	address := c.base() + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	agent := "gobib"
+	if c.Mailto != "" {
+		agent += " (mailto:" + c.Mailto + ")"
+	}
+	request.Header.Set("User-Agent", agent)
+	request.Header.Set("Accept", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = defaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return gobib.ErrNotResolved
+	case response.StatusCode != http.StatusOK:
+		return fmt.Errorf("crossref: %s", response.Status)
+	}
+	if err = json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("crossref: %w", err)
+	}
+	return nil
+}
+
+// entry returns the entry of a work, whose source is its API URL.
+func (c *Crossref) entry(w *work) *gobib.Entry {
+	entry := &gobib.Entry{
+		Type:   "misc",
+		Fields: make(map[string]string),
+		Source: gobib.Source{File: c.base() + "/works/" + w.DOI},
+	}
+	if bibType, ok := workTypes[w.Type]; ok {
+		entry.Type = bibType
+	}
+	if len(w.Title) > 0 {
+		entry.Title = cleanText(w.Title[0])
+	}
+	for _, author := range w.Author {
+		switch {
+		case author.Family != "":
+			entry.Authors = append(entry.Authors, strings.TrimSpace(author.Given+" "+author.Family))
+		case author.Name != "":
+			// an organization, protected from being split
+			entry.Authors = append(entry.Authors, "{"+author.Name+"}")
+		}
+	}
+	if len(w.Issued.DateParts) > 0 && len(w.Issued.DateParts[0]) > 0 {
+		entry.Year = w.Issued.DateParts[0][0]
+	}
+
+	if len(w.ContainerTitle) > 0 {
+		switch entry.Type {
+		case "article":
+			entry.Fields["journal"] = cleanText(w.ContainerTitle[0])
+		case "inproceedings", "incollection":
+			entry.Fields["booktitle"] = cleanText(w.ContainerTitle[0])
+		}
+	}
+	if w.DOI != "" {
+		entry.Fields["doi"] = strings.ToLower(w.DOI)
+	}
+	if w.Volume != "" {
+		entry.Fields["volume"] = w.Volume
+	}
+	if w.Issue != "" {
+		entry.Fields["number"] = w.Issue
+	}
+	if w.Page != "" {
+		entry.Fields["pages"] = strings.Replace(w.Page, "-", "--", 1)
+	}
+	if w.Publisher != "" && entry.Type != "article" {
+		entry.Fields["publisher"] = w.Publisher
+	}
+	return entry
+}
+
+// cleanText removes the markup and the extra spaces from a text.
+func cleanText(text string) string {
+	return strings.Join(strings.Fields(markupRegexp.ReplaceAllString(text, "")), " ")
+}
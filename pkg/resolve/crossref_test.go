@@ -0,0 +1,169 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package resolve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+const wcfWork = `{
+	"DOI": "10.1145/175222.175223",
+	"type": "journal-article",
+	"title": ["Why  cryptosystems <i>fail</i>"],
+	"container-title": ["Communications of the ACM"],
+	"author": [{"given": "Ross", "family": "Anderson"}],
+	"issued": {"date-parts": [[1993, 11]]},
+	"volume": "37",
+	"issue": "11",
+	"page": "32-40",
+	"publisher": "ACM"
+}`
+
+const otherWork = `{
+	"DOI": "10.1000/other",
+	"type": "proceedings-article",
+	"title": ["Why Cryptosystems Don't Fail"],
+	"container-title": ["Proc. Something"],
+	"author": [{"name": "The Committee"}],
+	"issued": {"date-parts": [[1993]]}
+}`
+
+// stubCrossref returns a server answering like the Crossref API,
+// which knows only two works.
+func stubCrossref(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("mailto") != "me@example.com" {
+			t.Errorf("Wrong mailto: %s", r.URL.RawQuery)
+		}
+		switch r.URL.Path {
+		case "/works/10.1145/175222.175223":
+			w.Write([]byte(`{"status": "ok", "message": ` + wcfWork + `}`))
+		case "/works/10.1000/broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		case "/works":
+			if r.URL.Query().Get("query.author") != "Anderson" {
+				w.Write([]byte(`{"status": "ok", "message": {"items": []}}`))
+				return
+			}
+			w.Write([]byte(`{"status": "ok", "message": {"items": [` + otherWork + `, ` + wcfWork + `]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestCrossrefDOI(t *testing.T) {
+	server := stubCrossref(t)
+	defer server.Close()
+	crossref := &Crossref{BaseURL: server.URL + "/", Mailto: "me@example.com"}
+
+	entry := gobib.NewEntry("wcf", []string{"R. Anderson"}, "why cryptosystems fail", 0, "", nil)
+	entry.Fields = map[string]string{"doi": "https://doi.org/10.1145/175222.175223"}
+	resolved, err := crossref.Resolve(entry)
+	if err != nil {
+		t.Fatalf("Fail to resolve: %s", err)
+	}
+	if resolved.Type != "article" || resolved.Title != "Why cryptosystems fail" || resolved.Year != 1993 {
+		t.Errorf("Wrong entry: %s", resolved)
+	}
+	if len(resolved.Authors) != 1 || resolved.Authors[0] != "Ross Anderson" {
+		t.Errorf("Wrong authors: %v", resolved.Authors)
+	}
+	expected := map[string]string{
+		"journal": "Communications of the ACM",
+		"volume":  "37",
+		"number":  "11",
+		"pages":   "32--40",
+		"doi":     "10.1145/175222.175223",
+	}
+	if len(resolved.Fields) != len(expected) {
+		t.Errorf("Wrong fields: %v", resolved.Fields)
+	}
+	for field, value := range expected {
+		if resolved.Fields[field] != value {
+			t.Errorf("Wrong %s: %q", field, resolved.Fields[field])
+		}
+	}
+	if resolved.Source.File != server.URL+"/works/10.1145/175222.175223" {
+		t.Errorf("Wrong source: %s", resolved.Source.File)
+	}
+
+	entry.Fields["doi"] = "10.1000/missing"
+	if _, err = crossref.Resolve(entry); !errors.Is(err, gobib.ErrNotResolved) {
+		t.Errorf("Wrong error for a missing DOI: %v", err)
+	}
+	entry.Fields["doi"] = "10.1000/broken"
+	if _, err = crossref.Resolve(entry); err == nil || errors.Is(err, gobib.ErrNotResolved) {
+		t.Errorf("Wrong error for a server error: %v", err)
+	}
+}
+
+func TestCrossrefSearch(t *testing.T) {
+	server := stubCrossref(t)
+	defer server.Close()
+	crossref := &Crossref{BaseURL: server.URL, Mailto: "me@example.com"}
+
+	// the first work has a similar title, but not the same author
+	entry := gobib.NewEntry("wcf", []string{"R. Anderson"}, "Why Cryptosystems Fail", 1993, "", nil)
+	resolved, err := crossref.Resolve(entry)
+	if err != nil {
+		t.Fatalf("Fail to resolve: %s", err)
+	}
+	if resolved.Fields["doi"] != "10.1145/175222.175223" {
+		t.Errorf("Wrong work: %s", resolved)
+	}
+
+	entry.Year = 2000
+	if _, err = crossref.Resolve(entry); !errors.Is(err, gobib.ErrNotResolved) {
+		t.Errorf("Wrong error for another year: %v", err)
+	}
+	entry = gobib.NewEntry("x", []string{"Someone Else"}, "Whatever", 0, "", nil)
+	if _, err = crossref.Resolve(entry); !errors.Is(err, gobib.ErrNotResolved) {
+		t.Errorf("Wrong error for an unknown work: %v", err)
+	}
+}
+
+func TestCrossrefEntry(t *testing.T) {
+	var w work
+	w.Type = "proceedings-article"
+	w.Title = []string{"A <scp>Title</scp>"}
+	w.ContainerTitle = []string{"Proc. Something"}
+	w.Author = append(w.Author, struct {
+		Given  string `json:"given"`
+		Family string `json:"family"`
+		Name   string `json:"name"`
+	}{Name: "The Committee"})
+	w.Publisher = "ACM"
+
+	entry := (&Crossref{}).entry(&w)
+	if entry.Type != "inproceedings" || entry.Title != "A Title" || entry.Fields["booktitle"] != "Proc. Something" {
+		t.Errorf("Wrong entry: %s", entry)
+	}
+	if entry.Authors[0] != "{The Committee}" || entry.Fields["publisher"] != "ACM" {
+		t.Errorf("Wrong entry: %s", entry)
+	}
+	w.Type = "dataset"
+	if entry = (&Crossref{}).entry(&w); entry.Type != "misc" {
+		t.Errorf("Wrong type: %s", entry.Type)
+	}
+}
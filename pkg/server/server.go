@@ -0,0 +1,419 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package server is an HTTP service converting plain TeX
+// bibliographies to BibTeX, and checking them.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+const (
+	// DefaultMaxBodySize is the default maximum size of a
+	// request body, 1 MiB.
+	DefaultMaxBodySize = 1 << 20
+	// DefaultTimeout is the default time limit of a conversion.
+	DefaultTimeout = 10 * time.Second
+	// DefaultMaxConcurrent is the default number of conversions
+	// running at once.
+	DefaultMaxConcurrent = 16
+)
+
+// ErrBusy is returned when too many conversions are running.
+var ErrBusy = errors.New("too many requests, retry later")
+
+// ErrTimeout is returned when a conversion takes too long.
+var ErrTimeout = errors.New("the conversion took too long")
+
+// texRegexp tells a plain TeX bibliography from a BibTeX one.
+var texRegexp = regexp.MustCompile(`\\(?:bibitem|bib\s*\{|begin\s*\{)`)
+
+// Config is the configuration of a Server.
+type Config struct {
+	// Base is the conversion config the options of each request
+	// are applied to. Its Input, Output and Warnings aren't used.
+	Base gobib.Config
+	// MaxBodySize is the maximum size of a request body, in
+	// bytes. If 0, DefaultMaxBodySize is used.
+	MaxBodySize int64
+	// Timeout is how long a conversion can last. If 0,
+	// DefaultTimeout is used.
+	Timeout time.Duration
+	// MaxConcurrent is how many conversions can run at once, the
+	// requests exceeding it are refused. If 0,
+	// DefaultMaxConcurrent is used.
+	MaxConcurrent int
+}
+
+// Server is the HTTP conversion service. It handles:
+//
+//	POST /convert  plain TeX in, BibTeX or JSON out
+//	POST /lint     plain TeX or BibTeX in, the diagnostics out
+//	POST /parse    plain TeX or BibTeX in, the entries and their
+//	               diagnostics out
+//
+// The options are read from the query, e.g. '?sort=key', or from
+// the headers, e.g. 'X-Gobib-Sort: key', and have the names of
+// the command line flags.
+type Server struct {
+	config Config
+	// slots holds a value for each running conversion
+	slots chan struct{}
+	mux   *http.ServeMux
+}
+
+// New returns a new Server.
+func New(config *Config) *Server {
+	s := &Server{config: *config}
+	if s.config.MaxBodySize <= 0 {
+		s.config.MaxBodySize = DefaultMaxBodySize
+	}
+	if s.config.Timeout <= 0 {
+		s.config.Timeout = DefaultTimeout
+	}
+	if s.config.MaxConcurrent <= 0 {
+		s.config.MaxConcurrent = DefaultMaxConcurrent
+	}
+	s.slots = make(chan struct{}, s.config.MaxConcurrent)
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/convert", s.post(s.convert))
+	s.mux.HandleFunc("/lint", s.post(s.lint))
+	s.mux.HandleFunc("/parse", s.post(s.parse))
+	return s
+}
+
+// ServeHTTP handles a request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// endpoint handles a request whose body has been read.
+type endpoint func(w http.ResponseWriter, r *http.Request, body []byte)
+
+// post returns a handler accepting only POST requests, whose body
+// is at most MaxBodySize bytes.
+func (s *Server) post(handle endpoint) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("only POST is allowed"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("the body is larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		handle(w, r, body)
+	}
+}
+
+// run runs f, the conversion, if there's a free slot, waiting
+// at most Timeout for it. When it takes longer, or the request
+// is canceled, f keeps its slot till it returns.
+func (s *Server) run(ctx context.Context, f func() error) error {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		return ErrBusy
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+		<-s.slots
+	}()
+
+	timer := time.NewTimer(s.config.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fail writes the error of a conversion.
+func fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrBusy):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, err)
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusServiceUnavailable, err)
+	case errors.Is(err, gobib.ErrOption):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		// the input can't be converted
+		writeError(w, http.StatusUnprocessableEntity, err)
+	}
+}
+
+// option returns the value of an option of the request, from
+// its query or, if not there, from its 'X-Gobib-' headers.
+func option(r *http.Request, name string) string {
+	if value := r.URL.Query().Get(name); value != "" {
+		return value
+	}
+	return r.Header.Get("X-Gobib-" + name)
+}
+
+// requestConfig returns the conversion config of a request: the
+// base one with the options of the request applied.
+func (s *Server) requestConfig(r *http.Request) (*gobib.Config, error) {
+	config := s.config.Base
+	for _, name := range gobib.Options {
+		if value := option(r, name); value != "" {
+			if err := config.SetOption(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &config, nil
+}
+
+// responseFormat returns the format of the /convert response,
+// 'bibtex' or 'json', set by the 'format' option or, if not set,
+// by the Accept header.
+func responseFormat(r *http.Request) (string, error) {
+	switch format := option(r, "format"); format {
+	case "bibtex", "json":
+		return format, nil
+	case "":
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			return "json", nil
+		}
+		return "bibtex", nil
+	default:
+		return "", fmt.Errorf("%w format: %s", gobib.ErrOption, format)
+	}
+}
+
+// inputKind returns the kind of the input of /lint and /parse,
+// 'tex' or 'bibtex', set by the 'input' option or, if not set,
+// guessed from the body.
+func inputKind(r *http.Request, body []byte) (string, error) {
+	switch kind := option(r, "input"); kind {
+	case "tex", "bibtex":
+		return kind, nil
+	case "":
+		if texRegexp.Match(body) {
+			return "tex", nil
+		}
+		return "bibtex", nil
+	default:
+		return "", fmt.Errorf("%w input: %s", gobib.ErrOption, kind)
+	}
+}
+
+// convertResponse is the JSON response of /convert.
+type convertResponse struct {
+	Output   string            `json:"output"`
+	Entries  int               `json:"entries"`
+	Warnings []string          `json:"warnings"`
+	Keys     map[string]string `json:"keys"`
+}
+
+// convert handles /convert.
+func (s *Server) convert(w http.ResponseWriter, r *http.Request, body []byte) {
+	config, err := s.requestConfig(r)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	format, err := responseFormat(r)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	var output, warnings bytes.Buffer
+	config.Input = bytes.NewReader(body)
+	config.Output = &output
+	config.Warnings = &warnings
+
+	converter := gobib.NewConverter(config)
+	err = s.run(r.Context(), converter.Run)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	if format == "json" {
+		writeJSON(w, &convertResponse{
+			Output:   output.String(),
+			Entries:  converter.Written(),
+			Warnings: warningLines(&warnings),
+			Keys:     converter.KeyMap(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-bibtex; charset=utf-8")
+	w.Write(output.Bytes())
+}
+
+// read returns the entries of the body, a plain TeX or BibTeX
+// bibliography, and the warnings.
+func (s *Server) read(r *http.Request, body []byte) ([]*gobib.Entry, []string, error) {
+	config, err := s.requestConfig(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	kind, err := inputKind(r, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []*gobib.Entry
+	var warnings bytes.Buffer
+	err = s.run(r.Context(), func() error {
+		var err error
+		if kind == "bibtex" {
+			entries, err = gobib.ParseBibTeX(bytes.NewReader(body), "")
+			return err
+		}
+		config.Input = bytes.NewReader(body)
+		config.Warnings = &warnings
+		entries, err = gobib.ReadEntries(config)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, warningLines(&warnings), nil
+}
+
+// lintResponse is the JSON response of /lint.
+type lintResponse struct {
+	Diagnostics []gobib.Diagnostic `json:"diagnostics"`
+	Warnings    []string           `json:"warnings"`
+}
+
+// lint handles /lint. A BibTeX syntax error is a diagnostic too.
+func (s *Server) lint(w http.ResponseWriter, r *http.Request, body []byte) {
+	entries, warnings, err := s.read(r, body)
+	response := &lintResponse{Diagnostics: []gobib.Diagnostic{}, Warnings: warnings}
+
+	var syntaxError *gobib.SyntaxError
+	if errors.As(err, &syntaxError) {
+		response.Diagnostics = append(response.Diagnostics, gobib.Diagnostic{
+			Rule:     "syntax",
+			Severity: gobib.SeverityError,
+			Message:  syntaxError.Msg,
+			Source:   gobib.Source{Line: syntaxError.Line},
+		})
+	} else if err != nil {
+		fail(w, err)
+		return
+	}
+
+	for _, entry := range entries {
+		response.Diagnostics = append(response.Diagnostics, gobib.Validate(entry)...)
+	}
+	writeJSON(w, response)
+}
+
+// parsedEntry is an entry in the /parse response.
+type parsedEntry struct {
+	Key         string             `json:"key"`
+	Type        string             `json:"type"`
+	Fields      map[string]string  `json:"fields"`
+	Line        int                `json:"line"`
+	Diagnostics []gobib.Diagnostic `json:"diagnostics"`
+}
+
+// parseResponse is the JSON response of /parse.
+type parseResponse struct {
+	Entries  []parsedEntry `json:"entries"`
+	Warnings []string      `json:"warnings"`
+}
+
+// parse handles /parse.
+func (s *Server) parse(w http.ResponseWriter, r *http.Request, body []byte) {
+	entries, warnings, err := s.read(r, body)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	response := &parseResponse{Entries: []parsedEntry{}, Warnings: warnings}
+	for _, entry := range entries {
+		parsed := parsedEntry{
+			Key:         entry.Key,
+			Type:        entry.Type,
+			Fields:      entry.FieldValues(),
+			Line:        entry.Source.Line,
+			Diagnostics: gobib.Validate(entry),
+		}
+		if parsed.Type == "" {
+			parsed.Type = "online"
+		}
+		if parsed.Diagnostics == nil {
+			parsed.Diagnostics = []gobib.Diagnostic{}
+		}
+		response.Entries = append(response.Entries, parsed)
+	}
+	writeJSON(w, response)
+}
+
+// warningLines returns the warnings written to a buffer, one
+// for each line, without the 'warning: ' prefix.
+func warningLines(warnings *bytes.Buffer) []string {
+	lines := []string{}
+	for _, line := range strings.Split(warnings.String(), "\n") {
+		if line != "" {
+			lines = append(lines, strings.TrimPrefix(line, "warning: "))
+		}
+	}
+	return lines
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as the JSON response
+// {"error": "..."}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,193 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const bibliography = `\begin{thebibliography}{9}
+\bibitem{wcf} Ross Anderson, Why Cryptosystems Fail, \url{https://example.com/wcf}, 1994
+\bibitem{aass} Asking Alexandria, Someone Somewhere
+\end{thebibliography}
+`
+
+const expectedSorted = `@online{aass,
+	author = "Asking Alexandria",
+	title = {{Someone Somewhere}},
+	year = "2018",
+}
+
+@online{wcf,
+	author = "Ross Anderson",
+	title = {{Why Cryptosystems Fail}},
+	year = "1994",
+	url = {https://example.com/wcf},
+}
+
+`
+
+const bibtexFile = `@article{wcf,
+  author = {Ross Anderson},
+  title = {Why Cryptosystems Fail},
+  year = 1994,
+}
+`
+
+func request(t *testing.T, s http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("Wrong JSON %q: %s", w.Body.String(), err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	s := New(&Config{})
+	w := request(t, s, http.MethodPost, "/convert?sort=key", bibliography, map[string]string{"X-Gobib-Default-Year": "2018"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got status %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Body.String(); got != expectedSorted {
+		t.Errorf("Got: '%s',\nExp: '%s'", got, expectedSorted)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/x-bibtex") {
+		t.Errorf("Wrong content type: %s", got)
+	}
+
+	w = request(t, s, http.MethodPost, "/convert?default-year=2018&sort=key", bibliography, map[string]string{"Accept": "application/json"})
+	var response convertResponse
+	decode(t, w, &response)
+	if response.Output != expectedSorted || response.Entries != 2 {
+		t.Errorf("Wrong response: %+v", response)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	s := New(&Config{MaxBodySize: 64})
+	tests := []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, "/convert", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/convert?sort=color", "\\begin{thebibliography}{9}\n\\end{thebibliography}\n", http.StatusBadRequest},
+		{http.MethodPost, "/convert?format=xml", "\\begin{thebibliography}{9}\n\\end{thebibliography}\n", http.StatusBadRequest},
+		{http.MethodPost, "/convert", bibliography, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/convert", "\\begin{thebibliography}{9}\n\\bibitem{a} A, B\n", http.StatusUnprocessableEntity},
+		{http.MethodPost, "/nothing", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := request(t, s, test.method, test.target, test.body, nil)
+		if w.Code != test.status {
+			t.Errorf("%s %s: got status %d, expected %d: %s", test.method, test.target, w.Code, test.status, w.Body.String())
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	s := New(&Config{})
+	w := request(t, s, http.MethodPost, "/parse", bibliography, nil)
+	var response parseResponse
+	decode(t, w, &response)
+	if len(response.Entries) != 2 {
+		t.Fatalf("Wrong entries: %+v", response.Entries)
+	}
+	wcf := response.Entries[0]
+	if wcf.Key != "wcf" || wcf.Type != "online" || wcf.Fields["year"] != "1994" || wcf.Fields["url"] != "https://example.com/wcf" || wcf.Line != 2 {
+		t.Errorf("Wrong entry: %+v", wcf)
+	}
+	if len(wcf.Diagnostics) != 0 {
+		t.Errorf("Unexpected diagnostics: %+v", wcf.Diagnostics)
+	}
+	// no year nor url
+	if len(response.Entries[1].Diagnostics) == 0 {
+		t.Errorf("Missing diagnostics: %+v", response.Entries[1])
+	}
+
+	w = request(t, s, http.MethodPost, "/parse", bibtexFile, nil)
+	response = parseResponse{}
+	decode(t, w, &response)
+	if len(response.Entries) != 1 || response.Entries[0].Type != "article" || response.Entries[0].Fields["title"] != "Why Cryptosystems Fail" {
+		t.Errorf("Wrong entries: %+v", response.Entries)
+	}
+}
+
+func TestLint(t *testing.T) {
+	s := New(&Config{})
+	w := request(t, s, http.MethodPost, "/lint", bibtexFile, nil)
+	var response lintResponse
+	decode(t, w, &response)
+	if len(response.Diagnostics) != 1 || response.Diagnostics[0].Rule != "required-field" {
+		t.Errorf("Wrong diagnostics: %+v", response.Diagnostics)
+	}
+
+	w = request(t, s, http.MethodPost, "/lint?input=bibtex", "@article{wcf,\n  title = {Why\n", nil)
+	response = lintResponse{}
+	decode(t, w, &response)
+	if len(response.Diagnostics) != 1 || response.Diagnostics[0].Rule != "syntax" {
+		t.Errorf("Wrong diagnostics: %+v", response.Diagnostics)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := New(&Config{MaxConcurrent: 1, Timeout: 10 * time.Millisecond})
+
+	release := make(chan struct{})
+	blocked := make(chan error)
+	go func() {
+		blocked <- s.run(context.Background(), func() error {
+			<-release
+			return nil
+		})
+	}()
+	if err := <-blocked; !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, got %v", err)
+	}
+
+	// the slot is still taken by the conversion timed out
+	w := request(t, s, http.MethodPost, "/convert", bibliography, nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Got status %d: %s", w.Code, w.Body.String())
+	}
+
+	close(release)
+	for i := 0; i < 100 && len(s.slots) > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	w = request(t, s, http.MethodPost, "/convert", bibliography, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("Got status %d: %s", w.Code, w.Body.String())
+	}
+}
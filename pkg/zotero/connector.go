@@ -0,0 +1,115 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package zotero
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// ErrNoCollection is an error that is returned when
+// importing into a collection that doesn't exist
+var ErrNoCollection = errors.New("no such collection")
+
+// target is a library or a collection items can be saved to,
+// as listed by the connector server.
+type target struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Import imports the entries into Zotero, into the collection
+// named collection or, if empty, into the one selected in Zotero.
+// It returns how many items were created.
+func (c *Client) Import(entries []*gobib.Entry, collection string) (int, error) {
+	targetID := ""
+	if collection != "" {
+		var err error
+		if targetID, err = c.collection(collection); err != nil {
+			return 0, err
+		}
+	}
+
+	var bibtex strings.Builder
+	for _, entry := range entries {
+		bibtex.WriteString(entry.String() + "\n\n")
+	}
+	session, err := newSession()
+	if err != nil {
+		return 0, err
+	}
+	content, err := c.post("/connector/import?session="+url.QueryEscape(session), "application/x-bibtex", []byte(bibtex.String()), http.StatusCreated)
+	if err != nil {
+		return 0, err
+	}
+	var items []json.RawMessage
+	if err = json.Unmarshal(content, &items); err != nil {
+		return 0, fmt.Errorf("zotero: %w", err)
+	}
+
+	if targetID != "" {
+		// the items are imported into the selected collection,
+		// then moved to the chosen one
+		body, err := json.Marshal(map[string]string{"sessionID": session, "target": targetID})
+		if err != nil {
+			return 0, err
+		}
+		if _, err = c.post("/connector/updateSession", "application/json", body, http.StatusOK); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// collection returns the ID of the target of a collection.
+func (c *Client) collection(name string) (string, error) {
+	content, err := c.post("/connector/getSelectedCollection", "application/json", []byte("{}"), http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	var selected struct {
+		Targets []target `json:"targets"`
+	}
+	if err = json.Unmarshal(content, &selected); err != nil {
+		return "", fmt.Errorf("zotero: %w", err)
+	}
+	for _, target := range selected.Targets {
+		// the libraries are targets too, their ID starts by L
+		if strings.HasPrefix(target.ID, "C") && target.Name == name {
+			return target.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", name, ErrNoCollection)
+}
+
+// newSession returns a new random ID for an import session.
+func newSession() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,68 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package zotero
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+func TestImport(t *testing.T) {
+	z, server := newFakeZotero()
+	defer server.Close()
+	client := &Client{URL: server.URL}
+
+	entries := []*gobib.Entry{
+		gobib.NewEntry("wcf", []string{"Ross Anderson"}, "Why Cryptosystems Fail", 1994, "", nil),
+		gobib.NewEntry("other", []string{"Someone Else"}, "Whatever", 2000, "", nil),
+	}
+	created, err := client.Import(entries, "Papers")
+	if err != nil {
+		t.Fatalf("Fail to import: %s", err)
+	}
+	if created != 2 || len(z.imported) != 1 || len(z.moved) != 1 {
+		t.Fatalf("Wrong import: %d items, %v, %v", created, z.imported, z.moved)
+	}
+	for session, bibtex := range z.imported {
+		if !strings.Contains(bibtex, "@online{wcf,") || !strings.Contains(bibtex, "@online{other,") {
+			t.Errorf("Wrong BibTeX:\n%s", bibtex)
+		}
+		if z.moved[session] != "C2" {
+			t.Errorf("Wrong collection: %s", z.moved[session])
+		}
+	}
+
+	// without a collection, the items stay in the selected one
+	if _, err = client.Import(entries[:1], ""); err != nil {
+		t.Fatalf("Fail to import: %s", err)
+	}
+	if len(z.imported) != 2 || len(z.moved) != 1 {
+		t.Errorf("Wrong import: %v, %v", z.imported, z.moved)
+	}
+
+	// the libraries aren't collections
+	if _, err = client.Import(entries, "My Library"); !errors.Is(err, ErrNoCollection) {
+		t.Errorf("Wrong error: %v", err)
+	}
+	if len(z.imported) != 2 {
+		t.Errorf("Imported without a collection: %v", z.imported)
+	}
+}
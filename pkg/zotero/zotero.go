@@ -0,0 +1,269 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package zotero talks to a running Zotero: it looks the items up
+// through the JSON-RPC endpoint of the Better BibTeX plugin, and
+// imports BibTeX entries through the connector server, the one
+// the browser connectors use.
+package zotero
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+// DefaultURL is the URL of the Zotero connector server.
+const DefaultURL = "http://127.0.0.1:23119"
+
+// rpcPath is the path of the Better BibTeX JSON-RPC endpoint.
+const rpcPath = "/better-bibtex/json-rpc"
+
+// maxResponseSize is the largest response read from Zotero.
+const maxResponseSize = 16 << 20
+
+// Client is a client of a running Zotero. It's a gobib.Resolver
+// finding the entries among the Zotero items, so that their
+// citation keys can be reused.
+type Client struct {
+	// URL is the URL of Zotero, DefaultURL if empty.
+	URL string
+	// HTTP is the HTTP client, one with a 10 seconds
+	// timeout if nil.
+	HTTP *http.Client
+}
+
+// defaultClient is the client used when Client.HTTP is nil.
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// RPCError is an error returned by the JSON-RPC endpoint.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("zotero: %s (%d)", e.Message, e.Code)
+}
+
+// Item is a Zotero item, as returned by Better BibTeX:
+// CSL-JSON with the citation key.
+type Item struct {
+	CitationKey string `json:"citationKey"`
+	// Citekey is the citation key for the older
+	// Better BibTeX versions
+	Citekey        string `json:"citekey"`
+	Type           string `json:"type"`
+	Title          string `json:"title"`
+	ContainerTitle string `json:"container-title"`
+	Author         []struct {
+		Given   string `json:"given"`
+		Family  string `json:"family"`
+		Literal string `json:"literal"`
+	} `json:"author"`
+	Issued struct {
+		DateParts [][]interface{} `json:"date-parts"`
+	} `json:"issued"`
+	Volume    string `json:"volume"`
+	Issue     string `json:"issue"`
+	Page      string `json:"page"`
+	Publisher string `json:"publisher"`
+	DOI       string `json:"DOI"`
+	URL       string `json:"URL"`
+}
+
+// Key returns the citation key of the item.
+func (i *Item) Key() string {
+	if i.CitationKey != "" {
+		return i.CitationKey
+	}
+	return i.Citekey
+}
+
+// itemTypes maps the CSL types to the BibTeX ones,
+// the others are 'misc'.
+var itemTypes = map[string]string{
+	"article-journal":  "article",
+	"article-magazine": "article",
+	"paper-conference": "inproceedings",
+	"book":             "book",
+	"chapter":          "incollection",
+	"report":           "techreport",
+	"thesis":           "phdthesis",
+	"webpage":          "online",
+	"post-weblog":      "online",
+}
+
+// url returns the URL of Zotero, without the trailing slash.
+func (c *Client) url() string {
+	if c.URL == "" {
+		return DefaultURL
+	}
+	return strings.TrimRight(c.URL, "/")
+}
+
+// post posts body to path, returning the response body
+// when the status is the expected one.
+func (c *Client) post(path, contentType string, body []byte, status int) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodPost, c.url()+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	client := c.HTTP
+	if client == nil {
+		client = defaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != status {
+		message := strings.TrimSpace(string(content))
+		if message == "" {
+			message = response.Status
+		}
+		return nil, fmt.Errorf("zotero: %s: %s", path, message)
+	}
+	return content, nil
+}
+
+// Call calls a Better BibTeX JSON-RPC method, like 'item.search',
+// decoding its result into result. An error of the method is
+// returned as an *RPCError.
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		return err
+	}
+	content, err := c.post(rpcPath, "application/json", body, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err = json.Unmarshal(content, &response); err != nil {
+		return fmt.Errorf("zotero: %w", err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err = json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("zotero: %w", err)
+	}
+	return nil
+}
+
+// Search returns the items matching the terms, e.g. a title.
+func (c *Client) Search(terms string) ([]Item, error) {
+	var items []Item
+	err := c.Call("item.search", []interface{}{terms}, &items)
+	return items, err
+}
+
+// Resolve returns the Zotero item of the entry, found by its
+// title, with its citation key as key. An item is taken only when
+// it's a duplicate of the entry, see gobib.IsDuplicate.
+func (c *Client) Resolve(entry *gobib.Entry) (*gobib.Entry, error) {
+	if entry.Title == "" {
+		return nil, gobib.ErrNotResolved
+	}
+	items, err := c.Search(entry.Title)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		found := items[i].Entry()
+		if ok, _ := gobib.IsDuplicate(entry, found); ok && found.Key != "" {
+			return found, nil
+		}
+	}
+	return nil, gobib.ErrNotResolved
+}
+
+// Entry returns the item as an entry, whose source is its
+// 'zotero://' link.
+func (i *Item) Entry() *gobib.Entry {
+	entry := &gobib.Entry{
+		Type:   "misc",
+		Key:    i.Key(),
+		Title:  i.Title,
+		URL:    i.URL,
+		Fields: make(map[string]string),
+		Source: gobib.Source{File: "zotero://select/items/@" + i.Key()},
+	}
+	if bibType, ok := itemTypes[i.Type]; ok {
+		entry.Type = bibType
+	}
+	for _, author := range i.Author {
+		switch {
+		case author.Family != "":
+			entry.Authors = append(entry.Authors, strings.TrimSpace(author.Given+" "+author.Family))
+		case author.Literal != "":
+			entry.Authors = append(entry.Authors, "{"+author.Literal+"}")
+		}
+	}
+	if len(i.Issued.DateParts) > 0 && len(i.Issued.DateParts[0]) > 0 {
+		// the parts may be numbers or strings
+		fmt.Sscan(fmt.Sprint(i.Issued.DateParts[0][0]), &entry.Year)
+	}
+
+	if i.ContainerTitle != "" {
+		switch entry.Type {
+		case "article":
+			entry.Fields["journal"] = i.ContainerTitle
+		case "inproceedings", "incollection":
+			entry.Fields["booktitle"] = i.ContainerTitle
+		}
+	}
+	for field, value := range map[string]string{
+		"volume":    i.Volume,
+		"number":    i.Issue,
+		"pages":     strings.Replace(i.Page, "-", "--", 1),
+		"doi":       strings.ToLower(i.DOI),
+		"publisher": i.Publisher,
+	} {
+		if value != "" {
+			entry.Fields[field] = value
+		}
+	}
+	return entry
+}
@@ -0,0 +1,181 @@
+/*  gobib - convert TeX to BibTeX
+    Copyright (C) 2018 nbena
+
+    This program is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package zotero
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nbena/gobib/pkg/gobib"
+)
+
+const wcfItem = `{
+	"citationKey": "andersonWhyCryptosystemsFail1994",
+	"type": "article-journal",
+	"title": "Why cryptosystems fail",
+	"container-title": "Communications of the ACM",
+	"author": [{"given": "Ross", "family": "Anderson"}],
+	"issued": {"date-parts": [["1994", 11]]},
+	"volume": "37",
+	"issue": "11",
+	"page": "32-40",
+	"DOI": "10.1145/175222.175223"
+}`
+
+const oldItem = `{
+	"citekey": "committee2000",
+	"type": "report",
+	"title": "Why Cryptosystems Fail",
+	"author": [{"literal": "The Committee"}],
+	"issued": {"date-parts": [[2000]]}
+}`
+
+// fakeZotero is a stand-in for a running Zotero, with Better
+// BibTeX, keeping what is imported.
+type fakeZotero struct {
+	mutex    sync.Mutex
+	imported map[string]string
+	moved    map[string]string
+}
+
+func (z *fakeZotero) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+
+	switch r.URL.Path {
+	case rpcPath:
+		var call struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.Unmarshal(body, &call)
+		switch {
+		case call.Method != "item.search":
+			w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "error": {"code": -32601, "message": "method not found"}}`))
+		case strings.Contains(strings.ToLower(call.Params[0].(string)), "cryptosystems"):
+			w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "result": [` + oldItem + `, ` + wcfItem + `]}`))
+		default:
+			w.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "result": []}`))
+		}
+	case "/connector/getSelectedCollection":
+		w.Write([]byte(`{"id": 1, "name": "Inbox", "libraryID": 1, "targets": [
+			{"id": "L1", "name": "My Library", "level": 0},
+			{"id": "C1", "name": "Inbox", "level": 1},
+			{"id": "C2", "name": "Papers", "level": 1}]}`))
+	case "/connector/import":
+		session := r.URL.Query().Get("session")
+		if session == "" || !strings.HasPrefix(string(body), "@") {
+			http.Error(w, "bad import", http.StatusBadRequest)
+			return
+		}
+		z.imported[session] = string(body)
+		w.WriteHeader(http.StatusCreated)
+		items := strings.Repeat(`{"itemType": "journalArticle"},`, strings.Count(string(body), "\n@")+1)
+		w.Write([]byte("[" + strings.TrimSuffix(items, ",") + "]"))
+	case "/connector/updateSession":
+		var update struct {
+			SessionID string `json:"sessionID"`
+			Target    string `json:"target"`
+		}
+		json.Unmarshal(body, &update)
+		if _, ok := z.imported[update.SessionID]; !ok {
+			http.Error(w, "session not found", http.StatusBadRequest)
+			return
+		}
+		z.moved[update.SessionID] = update.Target
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeZotero() (*fakeZotero, *httptest.Server) {
+	z := &fakeZotero{imported: make(map[string]string), moved: make(map[string]string)}
+	return z, httptest.NewServer(z)
+}
+
+func TestSearch(t *testing.T) {
+	_, server := newFakeZotero()
+	defer server.Close()
+	client := &Client{URL: server.URL + "/"}
+
+	items, err := client.Search("Why cryptosystems fail")
+	if err != nil {
+		t.Fatalf("Fail to search: %s", err)
+	}
+	if len(items) != 2 || items[0].Key() != "committee2000" || items[1].Key() != "andersonWhyCryptosystemsFail1994" {
+		t.Errorf("Wrong items: %v", items)
+	}
+
+	entry := items[1].Entry()
+	if entry.Type != "article" || entry.Year != 1994 || entry.Authors[0] != "Ross Anderson" {
+		t.Errorf("Wrong entry: %s", entry)
+	}
+	if entry.Fields["journal"] != "Communications of the ACM" || entry.Fields["pages"] != "32--40" || entry.Fields["number"] != "11" {
+		t.Errorf("Wrong fields: %v", entry.Fields)
+	}
+	entry = items[0].Entry()
+	if entry.Type != "techreport" || entry.Year != 2000 || entry.Authors[0] != "{The Committee}" {
+		t.Errorf("Wrong entry: %s", entry)
+	}
+
+	var rpcErr *RPCError
+	if err = client.Call("item.nothing", []interface{}{}, nil); !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	_, server := newFakeZotero()
+	defer server.Close()
+	client := &Client{URL: server.URL}
+
+	entry := gobib.NewEntry("wcf", []string{"R. Anderson"}, "Why Cryptosystems Fail", 1994, "", nil)
+	found, err := client.Resolve(entry)
+	if err != nil {
+		t.Fatalf("Fail to resolve: %s", err)
+	}
+	if found.Key != "andersonWhyCryptosystemsFail1994" || found.Source.File != "zotero://select/items/@andersonWhyCryptosystemsFail1994" {
+		t.Errorf("Wrong entry: %s (%s)", found, found.Source)
+	}
+
+	for _, entry := range []*gobib.Entry{
+		gobib.NewEntry("x", []string{"Ross Anderson"}, "Why Cryptosystems Fail", 1990, "", nil),
+		gobib.NewEntry("x", []string{"Ross Anderson"}, "Security Engineering", 1994, "", nil),
+	} {
+		if _, err = client.Resolve(entry); !errors.Is(err, gobib.ErrNotResolved) {
+			t.Errorf("Wrong error for %s: %v", entry, err)
+		}
+	}
+
+	server.Close()
+	if _, err = client.Resolve(entry); err == nil || errors.Is(err, gobib.ErrNotResolved) {
+		t.Errorf("Wrong error without Zotero: %v", err)
+	}
+}